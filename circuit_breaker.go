@@ -1,6 +1,7 @@
 package httpxgo
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"sync/atomic"
@@ -36,6 +37,19 @@ type CircuitBreaker struct {
 	successCount  atomic.Uint32
 	state         atomic.Value
 	lastFailureAt atomic.Value
+	trips         atomic.Uint64
+	rejections    atomic.Uint64
+	openNanos     atomic.Int64
+}
+
+// BreakerMetrics are counters of the breaker health since it was created.
+type BreakerMetrics struct {
+	// Trips is number of times the breaker opened.
+	Trips uint64
+	// Rejections is number of requests rejected with [ErrCircuitBreakerOpen].
+	Rejections uint64
+	// OpenDuration is total time spent open including the current open period.
+	OpenDuration time.Duration
 }
 
 const (
@@ -62,8 +76,19 @@ func NewCircuitBreaker(config BreakerConfig) *CircuitBreaker {
 	return cb
 }
 
+// Execute records the outcome of a round trip. Cancellation by the caller (context.Canceled) says
+// nothing about the health of the downstream and is therefore neither counted as a failure nor as a
+// success. Deadline exceeded is still treated as failure since the downstream failed to respond in
+// time.
 func (cb *CircuitBreaker) Execute(r *http.Response, err error) {
-	if cb.config.TripFunc(r) || err != nil {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+		cb.OnFailure()
+		return
+	}
+	if r == nil || cb.config.TripFunc(r) {
 		cb.OnFailure()
 		return
 	}
@@ -73,12 +98,13 @@ func (cb *CircuitBreaker) Execute(r *http.Response, err error) {
 func (cb *CircuitBreaker) OnSuccess() {
 	switch cb.state.Load() {
 	case StateClosed:
-		cb.successCount.Add(1)
-		if cb.successCount.Load() >= cb.config.SuccessThreshold {
+		cb.failureCount.Store(0)
+	case StateHalfOpen:
+		if cb.successCount.Add(1) >= cb.config.SuccessThreshold {
+			cb.failureCount.Store(0)
+			cb.successCount.Store(0)
 			cb.state.Store(StateClosed)
 		}
-	case StateHalfOpen:
-		cb.failureCount.Store(0)
 	}
 }
 
@@ -86,25 +112,56 @@ func (cb *CircuitBreaker) OnFailure() {
 	switch cb.state.Load() {
 	case StateClosed:
 		if cb.failureCount.Add(1) >= cb.config.FailureThreshold {
-			cb.state.Store(StateOpen)
+			cb.open()
 		}
 	case StateHalfOpen:
-		cb.lastFailureAt.Store(time.Now().UnixNano())
-		cb.state.Store(StateOpen)
+		cb.open()
 	}
 }
 
+// open trips the breaker and records the time so it can be half opened after timeout.
+func (cb *CircuitBreaker) open() {
+	cb.lastFailureAt.Store(time.Now())
+	cb.successCount.Store(0)
+	cb.state.Store(StateOpen)
+	cb.trips.Add(1)
+}
+
+// PreRequest reports whether a request may proceed, it returns [ErrCircuitBreakerOpen] while the
+// breaker is open. Once timeout elapses the breaker is half opened letting requests through to
+// probe the downstream.
 func (cb *CircuitBreaker) PreRequest() error {
 	if cb.state.Load() == StateOpen {
-		if time.Since(cb.lastFailureAt.Load().(time.Time)) >= cb.config.Timeout {
-			cb.state.Store(StateHalfOpen)
+		if d := time.Since(cb.lastFailureAt.Load().(time.Time)); d >= cb.config.Timeout {
+			if cb.state.CompareAndSwap(StateOpen, StateHalfOpen) {
+				cb.openNanos.Add(int64(d))
+			}
 			return nil
 		}
+		cb.rejections.Add(1)
 		return ErrCircuitBreakerOpen
 	}
 	return nil
 }
 
+// Metrics returns the counters of the breaker for exporting to dashboards.
+func (cb *CircuitBreaker) Metrics() BreakerMetrics {
+	open := time.Duration(cb.openNanos.Load())
+	if cb.state.Load() == StateOpen {
+		open += time.Since(cb.lastFailureAt.Load().(time.Time))
+	}
+	return BreakerMetrics{
+		Trips:        cb.trips.Load(),
+		Rejections:   cb.rejections.Load(),
+		OpenDuration: open,
+	}
+}
+
+// State returns the current state of the breaker.
+func (cb *CircuitBreaker) State() CircuitBreakerState {
+	return cb.state.Load().(CircuitBreakerState)
+}
+
 func defaultTripFunc(r *http.Response) bool {
 	return r.StatusCode > 499
 }
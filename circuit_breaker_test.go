@@ -0,0 +1,200 @@
+package httpxgo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerFailsFast(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	cb := NewCircuitBreaker(BreakerConfig{FailureThreshold: 3, Timeout: time.Hour})
+	c := New().SetCircuitBreaker(cb)
+	for range 3 {
+		res, err := c.Get(srv.URL).Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	if cb.State() != StateOpen {
+		t.Fatalf("state = %s, want open", cb.State())
+	}
+
+	_, err := c.Get(srv.URL).Exec()
+	if !errors.Is(err, ErrCircuitBreakerOpen) {
+		t.Fatalf("err = %v, want ErrCircuitBreakerOpen", err)
+	}
+	if n := hits.Load(); n != 3 {
+		t.Fatalf("server hits = %d, want 3, open breaker must not send the request", n)
+	}
+
+	// Requests skipping the breaker are still sent
+	res, err := c.Get(srv.URL).SkipCircuitBreaker().Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if n := hits.Load(); n != 4 {
+		t.Fatalf("server hits = %d, want 4", n)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	cb := NewCircuitBreaker(BreakerConfig{FailureThreshold: 1, SuccessThreshold: 1, Timeout: time.Millisecond})
+	cb.Execute(nil, errors.New("down"))
+	if cb.State() != StateOpen {
+		t.Fatalf("state = %s, want open", cb.State())
+	}
+	time.Sleep(2 * time.Millisecond)
+	if err := cb.PreRequest(); err != nil {
+		t.Fatalf("half open breaker rejected request: %v", err)
+	}
+	if cb.State() != StateHalfOpen {
+		t.Fatalf("state = %s, want half-open", cb.State())
+	}
+	cb.Execute(&http.Response{StatusCode: http.StatusOK}, nil)
+	if cb.State() != StateClosed {
+		t.Fatalf("state = %s, want closed", cb.State())
+	}
+}
+
+func TestCircuitBreakerConcurrent(t *testing.T) {
+	cb := NewCircuitBreaker(BreakerConfig{FailureThreshold: 5, Timeout: time.Millisecond})
+	ok := &http.Response{StatusCode: http.StatusOK}
+	failed := &http.Response{StatusCode: http.StatusBadGateway}
+	var wg sync.WaitGroup
+	for i := range 32 {
+		wg.Go(func() {
+			for j := range 200 {
+				if cb.PreRequest() != nil {
+					continue
+				}
+				if (i+j)%3 == 0 {
+					cb.Execute(failed, nil)
+				} else {
+					cb.Execute(ok, nil)
+				}
+				_ = cb.State()
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func TestCircuitBreakerMetrics(t *testing.T) {
+	cb := NewCircuitBreaker(BreakerConfig{FailureThreshold: 1, Timeout: 20 * time.Millisecond})
+	cb.Execute(nil, errors.New("down"))
+	for range 2 {
+		if !errors.Is(cb.PreRequest(), ErrCircuitBreakerOpen) {
+			t.Fatal("want open breaker to reject")
+		}
+	}
+	time.Sleep(25 * time.Millisecond)
+	if err := cb.PreRequest(); err != nil {
+		t.Fatal(err)
+	}
+	m := cb.Metrics()
+	if m.Trips != 1 || m.Rejections != 2 {
+		t.Fatalf("trips = %d, rejections = %d, want 1 and 2", m.Trips, m.Rejections)
+	}
+	if m.OpenDuration < 20*time.Millisecond {
+		t.Fatalf("open duration = %v, want at least the timeout", m.OpenDuration)
+	}
+	// Failed probe opens the breaker again
+	cb.Execute(nil, errors.New("down"))
+	if m := cb.Metrics(); m.Trips != 2 {
+		t.Fatalf("trips = %d, want 2", m.Trips)
+	}
+}
+
+func TestCircuitBreakerIgnoresCallerCancel(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cb := NewCircuitBreaker(BreakerConfig{FailureThreshold: 3, Timeout: time.Hour})
+	c := New().SetCircuitBreaker(cb)
+	for range 5 {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		_, err := c.Get(srv.URL + "/slow").WithContext(ctx).Exec()
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want context canceled", err)
+		}
+	}
+	if cb.State() != StateClosed {
+		t.Fatalf("state = %s, want closed after caller cancellations", cb.State())
+	}
+
+	res, err := c.Get(srv.URL).Exec()
+	if err != nil {
+		t.Fatalf("request after cancellations: %v", err)
+	}
+	res.Body.Close()
+	if n := hits.Load(); n != 6 {
+		t.Fatalf("server hits = %d, want 6", n)
+	}
+}
+
+func TestSkipCircuitBreaker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	cb := NewCircuitBreaker(BreakerConfig{FailureThreshold: 2, Timeout: time.Hour})
+	c := New().SetCircuitBreaker(cb)
+	// Skipped failures are not recorded
+	for range 5 {
+		res, err := c.Get(srv.URL + "/fail").SkipCircuitBreaker().Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	if cb.State() != StateClosed || cb.failureCount.Load() != 0 {
+		t.Fatalf("state = %s, failures = %d, want closed without failures",
+			cb.State(), cb.failureCount.Load())
+	}
+
+	for range 2 {
+		res, err := c.Get(srv.URL + "/fail").Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	before := cb.Metrics()
+	// Health check succeeds while the breaker is open and doesn't close it
+	res, err := c.Get(srv.URL).SkipCircuitBreaker().Exec()
+	if err != nil {
+		t.Fatalf("skipped request with open breaker: %v", err)
+	}
+	res.Body.Close()
+	after := cb.Metrics()
+	if cb.State() != StateOpen || after.Trips != before.Trips || after.Rejections != before.Rejections {
+		t.Fatalf("state = %s, metrics %+v -> %+v, want open breaker unchanged",
+			cb.State(), before, after)
+	}
+}
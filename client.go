@@ -1,33 +1,111 @@
 package httpxgo
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TrailingSlashPolicy controls how the trailing slash of the request path is normalized.
+type TrailingSlashPolicy int
+
+const (
+	TrailingSlashPreserve TrailingSlashPolicy = iota // path is sent as is
+	TrailingSlashAdd                                 // "/users" is sent as "/users/"
+	TrailingSlashRemove                              // "/users/" is sent as "/users"
 )
 
 type Client struct {
+	mu                  sync.Mutex
+	variantSrc          *http.Transport
+	variants            map[string]*http.Transport
 	breaker             *CircuitBreaker
+	retryBudget         *RetryBudget
+	errorHook           ErrorHook
 	client              *http.Client
 	trace               bool
+	maxContentLength    int64
+	maxBodySize         int64
+	autoCloseBody       bool
+	preserveEncHeaders  bool
+	decompressFallback  bool
+	defaultContentType  string
+	trailingSlash       TrailingSlashPolicy
+	errorOnHTTPError    bool
+	upgradeInsecure     bool
+	redirectDisabled    bool
+	upgradeHosts        map[string]struct{}
 	decompressors       *contentTypeDecompressor
+	compressors         *contentTypeCompressor
 	contentTypeEncoders *contentTypeEncoders
+	encoderPreference   []string
+	redactHeaders       []string
 	contentTypeDecoders *contentTypeDecoders
+	logger              Logger
+	dialer              *net.Dialer
 }
 
 func New() *Client {
 	return (&Client{
 		client:              &http.Client{},
 		decompressors:       newDecompressor(),
+		compressors:         newCompressor(),
 		contentTypeEncoders: newContentTypeEncoders(),
 		contentTypeDecoders: newContentTypeDecoders(),
 	}).SetTransport(defaultTransport)
 }
 
+// SetCircuitBreaker guards requests of the client with the breaker. Requests are rejected with
+// [ErrCircuitBreakerOpen] without being sent while the breaker is open.
 func (c *Client) SetCircuitBreaker(b *CircuitBreaker) *Client {
 	c.breaker = b
 	return c
 }
 
+// SetLogger sets the logger receiving internal diagnostics of the client, nothing is logged by
+// default. Passing nil disables logging.
+func (c *Client) SetLogger(l Logger) *Client {
+	c.logger = l
+	return c
+}
+
+// SetRetryBudget sets the retry budget shared by all requests of the client, see [RetryBudget].
+func (c *Client) SetRetryBudget(b *RetryBudget) *Client {
+	c.retryBudget = b
+	return c
+}
+
+// SetErrorHook sets hook observing every error returned by [Request.Exec] along with the request,
+// such as transport, hook, http or circuit breaker errors. The hook is purely observational and
+// can not alter the returned error.
+func (c *Client) SetErrorHook(hook ErrorHook) *Client {
+	c.errorHook = hook
+	return c
+}
+
+// SetSensitiveHeaders sets the headers whose values are redacted by [Request.DumpCurl], by default
+// Authorization, Proxy-Authorization and Cookie are redacted.
+func (c *Client) SetSensitiveHeaders(headers ...string) *Client {
+	c.redactHeaders = headers
+	return c
+}
+
+func (c *Client) sensitiveHeaders() []string {
+	if c.redactHeaders == nil {
+		return defaultSensitiveHeaders
+	}
+	return c.redactHeaders
+}
+
 // SetTransport set the httptransport, if provided transport is nil, default transport will be used.
 func (c *Client) SetTransport(t http.RoundTripper) *Client {
 	if t != nil {
@@ -36,17 +114,215 @@ func (c *Client) SetTransport(t http.RoundTripper) *Client {
 	return c
 }
 
+// SetResponseHeaderTimeout sets the time to wait for response headers after the request is
+// written, so a server which accepts the connection but never responds fails fast. It has no
+// effect on custom transports other than [http.Transport].
+func (c *Client) SetResponseHeaderTimeout(d time.Duration) *Client {
+	if t := c.httpTransport(); t != nil {
+		t.ResponseHeaderTimeout = d
+	}
+	return c
+}
+
+// httpTransport returns the [http.Transport] owned by the client for configuration. The shared
+// default transport is cloned on first use so other clients are not affected. It returns nil for
+// custom transports other than [http.Transport].
+func (c *Client) httpTransport() *http.Transport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client.Transport == defaultTransport {
+		c.client.Transport = defaultTransport.Clone()
+	}
+	// Transport is about to be reconfigured, per request variants are rebuilt from it.
+	c.resetVariants(nil)
+	t, _ := c.client.Transport.(*http.Transport)
+	return t
+}
+
+// SetProxy sets the proxy func of the client, other clients are not affected. It has no effect on
+// custom transports other than [http.Transport].
+func (c *Client) SetProxy(proxy func(r *http.Request) (*url.URL, error)) *Client {
+	if t := c.httpTransport(); t != nil {
+		t.Proxy = proxy
+	}
+	return c
+}
+
+// SetSocketDialer sets the dial func used by the client for connecting to different sockets such
+// as unix, tcp, ipv4 and ipv6, other clients are not affected. It has no effect on custom
+// transports other than [http.Transport].
+func (c *Client) SetSocketDialer(f func(ctx context.Context, network, addr string) (net.Conn, error)) *Client {
+	if t := c.httpTransport(); t != nil {
+		t.DialContext = f
+	}
+	return c
+}
+
+// SetDialTimeout sets the maximum time the client waits for a connection to be established, 30
+// seconds by default. It replaces the dial func set with [Client.SetSocketDialer] and has no
+// effect on custom transports other than [http.Transport].
+func (c *Client) SetDialTimeout(d time.Duration) *Client {
+	return c.setDialer(func(dialer *net.Dialer) { dialer.Timeout = d })
+}
+
+// SetKeepAlivePeriod sets the interval of TCP keep-alive probes of the client connections, 30
+// seconds by default, a negative period disables keep-alive. It replaces the dial func set with
+// [Client.SetSocketDialer] and has no effect on custom transports other than [http.Transport].
+func (c *Client) SetKeepAlivePeriod(d time.Duration) *Client {
+	return c.setDialer(func(dialer *net.Dialer) { dialer.KeepAlive = d })
+}
+
+// setDialer applies fn to a copy of the client dialer so connections being dialed are not affected.
+func (c *Client) setDialer(fn func(*net.Dialer)) *Client {
+	t := c.httpTransport()
+	if t == nil {
+		return c
+	}
+	c.mu.Lock()
+	d := newDialer()
+	if c.dialer != nil {
+		*d = *c.dialer
+	}
+	fn(d)
+	c.dialer = d
+	c.mu.Unlock()
+	t.DialContext = d.DialContext
+	return c
+}
+
+// SetInsecureSkipVerify disables TLS certificate verification of the client when skip is true.
+// Certificates are verified by default, use it only for testing against self-signed hosts. It has
+// no effect on custom transports other than [http.Transport].
+func (c *Client) SetInsecureSkipVerify(skip bool) *Client {
+	if t := c.httpTransport(); t != nil {
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.InsecureSkipVerify = skip
+	}
+	return c
+}
+
 func (c *Client) EnableTrace() *Client {
 	c.trace = true
 	return c
 }
 
+// UpgradeInsecureRequests rewrites "http://" request URLs to "https://" before dialing. If hosts
+// are provided only requests to those hosts are upgraded, otherwise every request is upgraded.
+// Hosts are matched against the hostname without port.
+func (c *Client) UpgradeInsecureRequests(hosts ...string) *Client {
+	c.upgradeInsecure = true
+	if len(hosts) > 0 {
+		c.upgradeHosts = make(map[string]struct{}, len(hosts))
+		for _, h := range hosts {
+			c.upgradeHosts[strings.ToLower(h)] = struct{}{}
+		}
+	}
+	return c
+}
+
+// upgradeScheme upgrades the scheme of u to https if enabled for its host.
+func (c *Client) upgradeScheme(u *url.URL) {
+	if !c.upgradeInsecure || u.Scheme != "http" {
+		return
+	}
+	host := strings.ToLower(u.Hostname())
+	if c.upgradeHosts != nil {
+		if _, ok := c.upgradeHosts[host]; !ok {
+			return
+		}
+	}
+	u.Scheme = "https"
+	if u.Port() == "80" {
+		u.Host = strings.TrimSuffix(u.Host, ":80")
+	}
+}
+
+// EnableErrorOnHTTPError makes [Request.Exec] return an error for unsuccessful responses, see
+// [HTTPError] and [ProblemDetails].
+func (c *Client) EnableErrorOnHTTPError() *Client {
+	c.errorOnHTTPError = true
+	return c
+}
+
+// SetTrailingSlash sets the trailing slash normalization policy applied to the request path, by
+// default path is preserved. The root path and query strings are never modified.
+func (c *Client) SetTrailingSlash(policy TrailingSlashPolicy) *Client {
+	c.trailingSlash = policy
+	return c
+}
+
+// normalizeTrailingSlash applies the trailing slash policy to path of u.
+func (c *Client) normalizeTrailingSlash(u *url.URL) {
+	switch c.trailingSlash {
+	case TrailingSlashAdd:
+		if !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
+			if u.RawPath != "" {
+				u.RawPath += "/"
+			}
+		}
+	case TrailingSlashRemove:
+		if len(u.Path) > 1 && strings.HasSuffix(u.Path, "/") {
+			u.Path = strings.TrimRight(u.Path, "/")
+			if u.Path == "" {
+				u.Path = "/"
+			}
+			u.RawPath = strings.TrimRight(u.RawPath, "/")
+		}
+	}
+}
+
+// AutoCloseBody drains and closes the response body once a response hook has consumed it through
+// [Response.Bytes] or [Response.Decode], so the connection is returned to the pool even if the
+// caller forgets to close it. Bodies not consumed by hooks are left for the caller.
+func (c *Client) AutoCloseBody() *Client {
+	c.autoCloseBody = true
+	return c
+}
+
 // DisableRedirect disable the redirects in http.Client. By default redirect are not disabled and
 // follows upto configured redirects in http client.
 func (c *Client) DisableRedirect() *Client {
 	c.client.CheckRedirect = func(_ *http.Request, _ []*http.Request) error {
 		return http.ErrUseLastResponse
 	}
+	c.redirectDisabled = true
+	return c
+}
+
+// OnHeaderStripped sets callback reporting the names of headers, such as Authorization or Cookie,
+// which were dropped from a redirected request along with the host it's redirected to. Headers are
+// stripped by [http.Client] on redirects to a different domain. Redirects are followed up to 10
+// times unless a redirect policy is already set.
+func (c *Client) OnHeaderStripped(fn func(host string, headers []string)) *Client {
+	policy := c.client.CheckRedirect
+	c.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		prev := via[len(via)-1]
+		var stripped []string
+		for k := range prev.Header {
+			if _, ok := req.Header[k]; ok {
+				continue
+			}
+			// Body headers are dropped when the redirect changes method e.g. POST to GET on 303
+			if req.Method != prev.Method && strings.HasPrefix(k, "Content-") {
+				continue
+			}
+			stripped = append(stripped, k)
+		}
+		if len(stripped) > 0 {
+			slices.Sort(stripped)
+			fn(req.URL.Host, stripped)
+		}
+		if policy != nil {
+			return policy(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
 	return c
 }
 
@@ -56,41 +332,15 @@ func (c *Client) SetCookieJar(jar http.CookieJar) *Client {
 	return c
 }
 
-// SetDecompressor registers a decompression function for the given Content-Encoding name. Keys must
-// match the value of the Content-Encoding header exactly after trimming spaces.
-//
-// The default client provides decompressors for "gzip", "deflate", and "zlib". Calling
-// SetDecompressor with an existing key overrides the default implementation.
-//
-// Multi-encoding responses (e.g. "gzip, zlib") are treated as a single logical encoding. The
-// library does not attempt to chain multiple encodings internally. If a server sends multiple
-// encodings, register a decompressor using the exact header value (e.g. "gzip, zlib") and implement
-// the decoding chain inside the provided function in reverse application order:
-//
-//	type decompressor struct {
-//		s io.ReadCloser
-//		r io.Reader
-//	}
-//
-//	func (d *decompressor) Read(p []byte) (n int, err error) {
-//		return d.r.Read(p)
-//	}
+// SetDecompressor registers a decompression function for the given Content-Encoding name.
 //
-//	func (d *decompressor) Close() error {
-//		return d.s.Close()
-//	}
+// The default client provides decompressors for "gzip", "deflate", "zlib", "br" (brotli) and
+// "zstd". Calling SetDecompressor with an existing key overrides the default implementation.
 //
-//	func decompressCustom(r io.ReadCloser) (io.ReadCloser, error) {
-//		zr, err := zlib.NewReader(r)
-//		if err != nil {
-//			return err
-//		}
-//		gr, err := gzip.NewReader(zr)
-//		if err != nil {
-//			return err
-//		}
-//		return &decompressor{r: gr, s: r}
-//	}
+// Multi-encoding responses (e.g. "gzip, zlib") are decoded by chaining the decompressor of each
+// encoding in reverse application order, the response fails if any of the encodings has no
+// decompressor. A decompressor registered for the exact header value (e.g. "gzip, zlib") takes
+// precedence over chaining.
 //
 // Call SetDecompressor multiple times to register additional encodings.
 func (c *Client) SetDecompressor(key string, fn DecompressFn) *Client {
@@ -98,47 +348,245 @@ func (c *Client) SetDecompressor(key string, fn DecompressFn) *Client {
 	return c
 }
 
+// SetCompressor registers a request body compression function for the given Content-Encoding
+// name used by [Request.SetRequestCompression]. The default client provides compressors for
+// "gzip", "deflate", and "zlib", calling SetCompressor with an existing key overrides it.
+func (c *Client) SetCompressor(key string, fn CompressFn) *Client {
+	c.compressors.put(key, fn)
+	return c
+}
+
+// SetPreserveEncodingHeaders retains the original Content-Encoding and Content-Length headers of
+// decompressed responses, useful for passthrough proxying. Body is still decompressed for reads.
+// By default those headers are removed after decompression.
+func (c *Client) SetPreserveEncodingHeaders(b bool) *Client {
+	c.preserveEncHeaders = b
+	return c
+}
+
+// SetMaxDownloadContentLength rejects responses declaring a Content-Length larger than n before the
+// body is read, returning [ContentLengthError]. Responses which never have a body, such as
+// responses to HEAD, are not rejected. Responses without Content-Length are not affected, the body
+// as it's read is limited with [Client.SetMaxBodySize].
+func (c *Client) SetMaxDownloadContentLength(n int64) *Client {
+	c.maxContentLength = n
+	return c
+}
+
+// SetMaxBodySize limits the response body to n bytes, reading more than n bytes of the decompressed
+// body fails with [ErrBodyTooLarge]. Unlike [Client.SetMaxDownloadContentLength] the body is
+// limited as it's read so responses without Content-Length are limited too.
+func (c *Client) SetMaxBodySize(n int64) *Client {
+	c.maxBodySize = n
+	return c
+}
+
+// SetDecompressFallback serves the raw body instead of failing the request when the decompressor
+// can not be initialized, e.g. a 500 error page with broken gzip header. The Content-Encoding
+// header is kept so caller can tell the body is not decompressed.
+func (c *Client) SetDecompressFallback(b bool) *Client {
+	c.decompressFallback = b
+	return c
+}
+
+// SetContentTypeEncoder registers the encoder of request bodies for the content type. An encoder
+// for "application/x-www-form-urlencoded" accepting [url.Values] and string maps is registered by
+// default and can be overridden.
 func (c *Client) SetContentTypeEncoder(key string, fn ContentTypeEncFn) *Client {
 	c.contentTypeEncoders.set(key, fn)
 	return c
 }
 
+// SetEncoderPreference sets the content types, in order of preference, used to encode a body when
+// the request has no Content-Type header. The first content type with an available encoder is
+// chosen and set as Content-Type of the request. JSON and XML encoders are always available.
+func (c *Client) SetEncoderPreference(contentTypes []string) *Client {
+	c.encoderPreference = contentTypes
+	return c
+}
+
+// preferredContentType returns the first content type from the encoder preference which has an
+// encoder available.
+func (c *Client) preferredContentType() (string, bool) {
+	for _, ct := range c.encoderPreference {
+		if ct == contentTypeJSON || ct == contentTypeXML {
+			return ct, true
+		}
+		if _, ok := c.contentTypeEncoders.get(ct); ok {
+			return ct, true
+		}
+	}
+	return "", false
+}
+
+// SetDefaultDecodeContentType sets the content type used by [Response.Decode] when the response has
+// no Content-Type header, by default "application/json".
+func (c *Client) SetDefaultDecodeContentType(contentType string) *Client {
+	c.defaultContentType = contentType
+	return c
+}
+
 func (c *Client) SetContentTypeDecoder(key string, fn ContentTypeDecFn) *Client {
 	c.contentTypeDecoders.set(key, fn)
 	return c
 }
 
+// SetContentTypeDecoderMatcher registers a matcher consulted by [Response.Decode] when no decoder
+// is registered for the exact media type. It allows a single decoder to handle a family of types:
+//
+//	c.SetContentTypeDecoderMatcher(func(mt string) (httpxgo.ContentTypeDecFn, bool) {
+//		if strings.HasPrefix(mt, "text/") {
+//			return decodeText, true
+//		}
+//		return nil, false
+//	})
+//
+// Matchers are consulted in the order they were registered.
+func (c *Client) SetContentTypeDecoderMatcher(fn ContentTypeDecMatcherFn) *Client {
+	if fn != nil {
+		c.contentTypeDecoders.setMatcher(fn)
+	}
+	return c
+}
+
+// FromStdRequest wraps req so it can be executed with retry, circuit breaker and decompression. It
+// copies method, URL, headers, body and context of req. Query parameters of the URL are moved to
+// [Request.Queries]. Body of req is not replayable for retries unless it implements [io.Seeker].
+func (c *Client) FromStdRequest(req *http.Request) *Request {
+	r := c.newRequest(req.Method, "").WithContext(req.Context())
+	u := *req.URL
+	r.Queries = u.Query()
+	u.RawQuery = ""
+	r.SetURL(u.String())
+	r.Header = req.Header.Clone()
+	if r.Header == nil {
+		r.Header = make(http.Header)
+	}
+	if req.Host != "" && req.Host != req.URL.Host {
+		r.Header.Set("Host", req.Host)
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		r.SetBody(req.Body)
+		switch req.Method {
+		case http.MethodGet:
+			r.AllowGetPayload = true
+		case http.MethodDelete:
+			r.AllowDeletePayload = true
+		}
+	}
+	return r
+}
+
+// newRequest returns request bound to the client so it can be executed.
+func (c *Client) newRequest(method, url string) *Request {
+	r := NewRequest().SetMethod(method).SetURL(url)
+	r.client = c
+	return r
+}
+
 // Get is http get method
 func (c *Client) Get(url string) *Request {
-	return NewRequest().SetMethod(http.MethodGet).SetURL(url)
+	return c.newRequest(http.MethodGet, url)
 }
 
 // Head is http head method follows upto 10 redirect
 func (c *Client) Head(url string) *Request {
-	return NewRequest().SetMethod(http.MethodHead).SetURL(url)
+	return c.newRequest(http.MethodHead, url)
 }
 
 // Post is http post method
 func (c *Client) Post(url string, body any) *Request {
-	return NewRequest().SetMethod(http.MethodPost).SetURL(url).SetBody(body)
+	return c.newRequest(http.MethodPost, url).SetBody(body)
 }
 
 // Put is http put method
 func (c *Client) Put(url string, body any) *Request {
-	return NewRequest().SetMethod(http.MethodPut).SetURL(url).SetBody(body)
+	return c.newRequest(http.MethodPut, url).SetBody(body)
 }
 
 // Patch is http patch method
 func (c *Client) Patch(url string, body any) *Request {
-	return NewRequest().SetMethod(http.MethodPost).SetURL(url).SetBody(body)
+	return c.newRequest(http.MethodPatch, url).SetBody(body)
 }
 
 // Delete is http delete method
 func (c *Client) Delete(url string) *Request {
-	return NewRequest().SetMethod(http.MethodDelete).SetURL(url)
+	return c.newRequest(http.MethodDelete, url)
+}
+
+// DeleteWithBody is http delete method carrying a body, DELETE payload is allowed implicitly.
+func (c *Client) DeleteWithBody(url string, body any) *Request {
+	return c.Delete(url).SetBody(body).SetAllowDeletePayload(true)
+}
+
+// requestClient returns http client for r. Requests bypassing the proxy or pinning certificates are
+// sent over a variant of the client transport which is cached per configuration. Only
+// [http.Transport] can be varied, custom transports are used as is.
+func (c *Client) requestClient(r *Request) *http.Client {
+	if !r.noProxy && len(r.certPins) == 0 {
+		return c.client
+	}
+	t, ok := c.client.Transport.(*http.Transport)
+	if !ok {
+		return c.client
+	}
+
+	key := fmt.Sprintf("noproxy=%t;pins=%x", r.noProxy, r.certPins)
+	c.mu.Lock()
+	if c.variantSrc != t {
+		c.resetVariants(t)
+	}
+	vt, ok := c.variants[key]
+	if !ok {
+		vt = t.Clone()
+		if r.noProxy {
+			vt.Proxy = nil
+		}
+		if len(r.certPins) > 0 {
+			if vt.TLSClientConfig == nil {
+				vt.TLSClientConfig = &tls.Config{}
+			}
+			vt.TLSClientConfig.VerifyPeerCertificate = verifyCertPins(r.certPins)
+		}
+		c.variants[key] = vt
+	}
+	c.mu.Unlock()
+
+	hc := *c.client
+	hc.Transport = vt
+	return &hc
+}
+
+// resetVariants drops the per request variants built from the previous transport and closes their
+// idle connections, which would be kept open otherwise. The caller holds c.mu.
+func (c *Client) resetVariants(src *http.Transport) {
+	for _, vt := range c.variants {
+		vt.CloseIdleConnections()
+	}
+	c.variantSrc = src
+	c.variants = make(map[string]*http.Transport)
+}
+
+// hasBody reports whether response to method with status may carry a body. Responses to HEAD and
+// 1xx, 204 and 304 responses declare the length of a body which is never sent.
+func hasBody(method string, status int) bool {
+	if method == http.MethodHead || status < 200 {
+		return false
+	}
+	return status != http.StatusNoContent && status != http.StatusNotModified
 }
 
 func (c *Client) exec(r *Request) (*Response, error) {
+	useBreaker := c.breaker != nil && !r.skipBreaker
+	if useBreaker {
+		if err := c.breaker.PreRequest(); err != nil {
+			if c.logger != nil {
+				c.logger.Debug("httpx: circuit breaker rejected request", "url", r.URI)
+			}
+			return nil, err
+		}
+	}
+
 	// Execute all the request hooks
 	for i := 0; i < len(r.reqHooks); i++ {
 		if err := r.reqHooks[i](c, r); err != nil {
@@ -146,26 +594,74 @@ func (c *Client) exec(r *Request) (*Response, error) {
 		}
 	}
 
-	res, err := c.client.Do(r.RawRequest) //nolint:bodyClose
+	res, err := c.requestClient(r).Do(r.RawRequest) //nolint:bodyClose
+	if useBreaker {
+		from := c.breaker.State()
+		c.breaker.Execute(res, err)
+		if to := c.breaker.State(); to != from && c.logger != nil {
+			c.logger.Warn("httpx: circuit breaker state changed", "from", from, "to", to)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
+	limit, readLimit := c.maxContentLength, c.maxBodySize
+	if r.maxBodySize != 0 {
+		limit, readLimit = r.maxBodySize, r.maxBodySize
+	}
+	if limit > 0 && res.ContentLength > limit && hasBody(r.Method, res.StatusCode) {
+		res.Body.Close()
+		return nil, &ContentLengthError{ContentLength: res.ContentLength, Limit: limit}
+	}
 	resp := &Response{
 		Response:            res,
 		traceInfo:           r.tracer,
 		decompressors:       c.decompressors,
+		reqDecompressors:    r.decompressors,
 		contentTypeDecoders: c.contentTypeDecoders,
+		preserveEncHeaders:  c.preserveEncHeaders,
+		decompressFallback:  c.decompressFallback,
+		defaultContentType:  c.defaultContentType,
+		meta:                r.meta,
+		earlyHints:          r.earlyHints,
+		successCond:         r.successCond,
+		ctEncodings:         r.ctEncodings,
+		wireContentLength:   res.ContentLength,
+		rawBody:             res.Body,
 	}
-	if err := resp.wrapDecompressor(); err != nil {
-		return nil, err
+	// Byte ranges of a compressed body don't map to decompressed offsets so ranged responses are
+	// served raw, transport doesn't advertise Accept-Encoding for them either.
+	if r.Header.Get("Range") == "" {
+		enc := res.Header.Get("Content-Encoding")
+		if err := resp.wrapDecompressor(); err != nil {
+			return nil, err
+		}
+		if enc != "" && c.logger != nil {
+			c.logger.Debug("httpx: decompressing response", "encoding", enc)
+		}
+	}
+	if readLimit > 0 {
+		resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: readLimit}
 	}
+	resp.Body = &contextBody{ReadCloser: resp.Body, ctx: r.ctx}
 
-	// WARN: In case of retry if body is read in in response hooks
-	// then reading body in payload based retry condition will case issue.
+	// Response hooks run only without retry, reading the body in response hooks would conflict
+	// with payload based retry conditions. See [Request.Exec] for the hook order.
+	if r.IsRetry {
+		return resp, nil
+	}
 	for i := 0; i < len(r.respHooks); i++ {
 		if err := r.respHooks[i](c, resp); err != nil {
+			if errors.Is(err, ErrStopHooks) {
+				break
+			}
+			resp.Body.Close()
 			return nil, fmt.Errorf("failed to execute response hook: %w", err)
 		}
 	}
+	if c.autoCloseBody && resp.IsRead && !resp.IsReused {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
 	return resp, nil
 }
@@ -0,0 +1,422 @@
+package httpxgo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPatchSendsPatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Write([]byte(r.Method + " " + string(b)))
+	}))
+	defer srv.Close()
+
+	res, err := New().Patch(srv.URL, "update").Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	got, _ := res.String()
+	if got != "PATCH update" {
+		t.Fatalf("server received %q, want PATCH with body", got)
+	}
+}
+
+func TestMaxDownloadContentLengthSkipsHead(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10000000")
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.Write(make([]byte, 10000000))
+	}))
+	defer srv.Close()
+
+	c := New().SetMaxDownloadContentLength(1024)
+	res, err := c.Head(srv.URL).Exec()
+	if err != nil {
+		t.Fatalf("HEAD: %v", err)
+	}
+	res.Body.Close()
+	if res.ContentLength != 10000000 {
+		t.Fatalf("content length = %d, want the declared length", res.ContentLength)
+	}
+	_, err = c.Get(srv.URL).Exec()
+	var clErr *ContentLengthError
+	if !errors.As(err, &clErr) {
+		t.Fatalf("GET: err = %v, want ContentLengthError", err)
+	}
+}
+
+// sizedServer responds with a body of the size in the "n" query, chunked when "chunked" is set.
+func sizedServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		if r.URL.Query().Has("chunked") {
+			w.(http.Flusher).Flush()
+		} else {
+			w.Header().Set("Content-Length", strconv.Itoa(n))
+		}
+		w.Write(bytes.Repeat([]byte("x"), n))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestMaxDownloadContentLengthIsPreflightOnly(t *testing.T) {
+	srv := sizedServer(t)
+	c := New().SetMaxDownloadContentLength(1024)
+
+	_, err := c.Get(srv.URL).SetQuery("n", "1025").Exec()
+	var clErr *ContentLengthError
+	if !errors.As(err, &clErr) || clErr.ContentLength != 1025 || clErr.Limit != 1024 {
+		t.Fatalf("declared length over the limit: err = %v, want ContentLengthError", err)
+	}
+
+	// Bodies without Content-Length are not limited by the preflight
+	res, err := c.Get(srv.URL).SetQuery("n", "4096").SetQuery("chunked", "1").Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if b, err := res.Bytes(); err != nil || len(b) != 4096 {
+		t.Fatalf("chunked body: read %d bytes, err = %v", len(b), err)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	srv := sizedServer(t)
+	c := New().SetMaxBodySize(1024)
+	tests := []struct {
+		n       string
+		chunked bool
+		wantErr error
+	}{
+		{"1024", false, nil},
+		{"1024", true, nil},
+		{"1025", false, ErrBodyTooLarge},
+		{"4096", true, ErrBodyTooLarge},
+	}
+	for _, tt := range tests {
+		req := c.Get(srv.URL).SetQuery("n", tt.n)
+		if tt.chunked {
+			req.SetQuery("chunked", "1")
+		}
+		res, err := req.Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = res.Bytes()
+		res.Body.Close()
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("n = %s, chunked = %t: err = %v, want %v", tt.n, tt.chunked, err, tt.wantErr)
+		}
+	}
+
+	// Request override allows a larger body
+	res, err := c.Get(srv.URL).SetQuery("n", "4096").SetMaxBodySize(8192).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if _, err := res.Bytes(); err != nil {
+		t.Fatalf("request override: %v", err)
+	}
+}
+
+func TestTrailingSlashPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RequestURI()))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		policy TrailingSlashPolicy
+		path   string
+		want   string
+	}{
+		{TrailingSlashPreserve, "/users", "/users?id=1"},
+		{TrailingSlashPreserve, "/users/", "/users/?id=1"},
+		{TrailingSlashAdd, "/users", "/users/?id=1"},
+		{TrailingSlashAdd, "/users/", "/users/?id=1"},
+		{TrailingSlashRemove, "/users/", "/users?id=1"},
+		{TrailingSlashRemove, "/users", "/users?id=1"},
+		{TrailingSlashRemove, "/", "/?id=1"},
+	}
+	for _, tt := range tests {
+		res, err := New().SetTrailingSlash(tt.policy).Get(srv.URL+tt.path).SetQuery("id", "1").Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := res.String()
+		res.Body.Close()
+		if got != tt.want {
+			t.Errorf("policy %d, %s: sent %s, want %s", tt.policy, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAutoCloseBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Trailing whitespace is left unread by the JSON decoder
+		w.Write(append([]byte(`{"id":1}`), bytes.Repeat([]byte(" "), 64<<10)...))
+	}))
+	defer srv.Close()
+
+	reusedConn := func(c *Client) bool {
+		var reused bool
+		ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) { reused = info.Reused },
+		})
+		res, err := c.Get(srv.URL).WithContext(ctx).Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Close()
+		return reused
+	}
+	decodeHook := func(_ *Client, res *Response) error {
+		var v map[string]int
+		return res.Decode(&v)
+	}
+
+	for _, autoClose := range []bool{true, false} {
+		c := New()
+		if autoClose {
+			c.AutoCloseBody()
+		}
+		// Body consumed by the hook is never closed by the caller
+		if _, err := c.Get(srv.URL).SetResponseHook(decodeHook).Exec(); err != nil {
+			t.Fatal(err)
+		}
+		if got := reusedConn(c); got != autoClose {
+			t.Errorf("AutoCloseBody %v: connection reused = %v", autoClose, got)
+		}
+	}
+
+	// Bodies not consumed by hooks are left for the caller
+	res, err := New().AutoCloseBody().Get(srv.URL).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var v map[string]int
+	if err := res.Decode(&v); err != nil || v["id"] != 1 {
+		t.Fatalf("caller decode: %v, %v", v, err)
+	}
+}
+
+func TestFromStdRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s %s %s", r.Method, r.URL.RequestURI(), r.Host,
+			r.Header.Get("X-Test"), b)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	std, err := http.NewRequestWithContext(ctx, http.MethodPut, srv.URL+"/items?id=1&id=2",
+		strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	std.Header.Set("X-Test", "yes")
+	std.Host = "api.example.test"
+
+	req := New().FromStdRequest(std)
+	res, err := req.Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := res.String()
+	res.Body.Close()
+	if want := "PUT /items?id=1&id=2 api.example.test yes payload"; got != want {
+		t.Fatalf("server received %q, want %q", got, want)
+	}
+	if req.Context() != ctx {
+		t.Fatal("context of the standard request was not kept")
+	}
+	// Headers are copied, changes to the wrapped request don't leak into the original one
+	req.Header.Set("X-Test", "changed")
+	if std.Header.Get("X-Test") != "yes" {
+		t.Fatal("header of the standard request was modified")
+	}
+}
+
+func TestDeletePayloadAllowedOnlyWithBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.Header.Get("Content-Type"), b)
+	}))
+	defer srv.Close()
+
+	c := New()
+	for _, tt := range []struct {
+		req  *Request
+		want string
+	}{
+		{c.Delete(srv.URL).SetBodyJSON(map[string]int{"id": 1}), "DELETE application/json "},
+		{c.DeleteWithBody(srv.URL, nil).SetBodyJSON(map[string]int{"id": 1}),
+			`DELETE application/json {"id":1}`},
+	} {
+		res, err := tt.req.Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := res.String()
+		res.Body.Close()
+		if got != tt.want {
+			t.Errorf("server received %q, want %q", got, tt.want)
+		}
+	}
+}
+
+// logRecorder records the messages logged at each level.
+type logRecorder struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *logRecorder) Debug(msg string, keyvals ...any) { l.log("debug", msg, keyvals) }
+func (l *logRecorder) Warn(msg string, keyvals ...any)  { l.log("warn", msg, keyvals) }
+
+func (l *logRecorder) log(level, msg string, keyvals []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprint(level, " ", msg, " ", keyvals))
+}
+
+func TestLogger(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	logs := &logRecorder{}
+	cb := NewCircuitBreaker(BreakerConfig{FailureThreshold: 2, Timeout: time.Hour})
+	res, err := New().SetLogger(logs).SetCircuitBreaker(cb).Get(srv.URL).
+		SetRetry(&Retry{Count: 1, Wait: time.Millisecond}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if _, err := New().SetLogger(logs).SetCircuitBreaker(cb).Get(srv.URL).Exec(); err == nil {
+		t.Fatal("want error from the open breaker")
+	}
+
+	want := []string{
+		"debug httpx: retrying request [url " + srv.URL + " attempt 1 status 503",
+		"warn httpx: circuit breaker state changed [from closed to open]",
+		"debug httpx: circuit breaker rejected request [url " + srv.URL + "]",
+	}
+	if len(logs.lines) != len(want) {
+		t.Fatalf("logged %q, want %d lines", logs.lines, len(want))
+	}
+	for i, line := range logs.lines {
+		if !strings.HasPrefix(line, want[i]) {
+			t.Errorf("line %d = %q, want prefix %q", i, line, want[i])
+		}
+	}
+}
+
+func TestRangeRequestSkipsDecompression(t *testing.T) {
+	full := gzipBytes(t, bytes.Repeat([]byte("httpx-go "), 256))
+	var acceptEncoding []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = append(acceptEncoding, r.Header.Get("Accept-Encoding"))
+		// Bytes of the compressed representation which can not be decompressed on their own
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 10-29/%d", len(full)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(full[10:30])
+	}))
+	defer srv.Close()
+
+	res, err := New().Get(srv.URL).SetHeader("Range", "bytes=10-29").Exec()
+	if err != nil {
+		t.Fatalf("decompression attempted for ranged response: %v", err)
+	}
+	defer res.Body.Close()
+	got, err := res.Bytes()
+	if err != nil || !bytes.Equal(got, full[10:30]) {
+		t.Fatalf("body = %x, %v, want the raw range %x", got, err, full[10:30])
+	}
+	if len(acceptEncoding) != 1 || acceptEncoding[0] != "" {
+		t.Fatalf("Accept-Encoding = %q, want none advertised for ranged request", acceptEncoding)
+	}
+}
+
+func TestOnHeaderStripped(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	defer target.Close()
+	// Same server under a different host name, headers are stripped on redirects across hosts
+	u, _ := url.Parse(target.URL)
+	other := "http://localhost:" + u.Port()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other+r.URL.Path, http.StatusFound)
+	}))
+	defer srv.Close()
+
+	type report struct {
+		host    string
+		headers []string
+	}
+	var reports []report
+	c := New().OnHeaderStripped(func(host string, headers []string) {
+		reports = append(reports, report{host, headers})
+	})
+	res, err := c.Get(srv.URL).SetBearerToken("secret").
+		SetHeader("Cookie", "id=1").SetHeader("X-Trace", "t").Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := res.String()
+	res.Body.Close()
+	if got != "" {
+		t.Fatalf("Authorization %q sent across hosts", got)
+	}
+	want := []string{"Authorization", "Cookie"}
+	if len(reports) != 1 || reports[0].host != "localhost:"+u.Port() ||
+		!slices.Equal(reports[0].headers, want) {
+		t.Fatalf("reported %+v, want %v stripped for localhost", reports, want)
+	}
+
+	// Same host redirects keep the headers
+	reports = nil
+	same := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/final", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	defer same.Close()
+	res, err = c.Get(same.URL).SetBearerToken("secret").Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = res.String()
+	res.Body.Close()
+	if got != "Bearer secret" || len(reports) != 0 {
+		t.Fatalf("Authorization = %q, reported %+v for same host redirect", got, reports)
+	}
+}
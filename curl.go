@@ -0,0 +1,108 @@
+package httpxgo
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// defaultSensitiveHeaders are redacted from curl commands unless configured otherwise with
+// [Client.SetSensitiveHeaders].
+var defaultSensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// DumpCurl renders the request as an equivalent copy-pasteable curl command. The request is built
+// the same way [Request.Exec] builds it without modifying the request, values of sensitive headers
+// are redacted. Bodies which are [io.Reader] must implement [io.Seeker] to be rendered. Files of
+// multipart forms are not read, they're rendered as "-F field=@filename" referring to a local file.
+func (r *Request) DumpCurl() (string, error) {
+	var form *MultipartForm
+	switch b := r.Body.(type) {
+	case *MultipartForm:
+		form = b
+	case multipartStreamBody:
+		form = b.form
+	case io.Reader:
+		if _, ok := b.(io.Seeker); !ok {
+			if _, ok := b.(*bytes.Buffer); !ok {
+				return "", errors.New("body is not replayable can not be dumped")
+			}
+		}
+	}
+	restore := func() error { return nil }
+	c := r.boundClient()
+	cp := *r
+	cp.Header = r.Header.Clone()
+	cp.Attempt = 0
+	if form != nil {
+		// curl builds the form along with its Content-Type boundary itself
+		cp.Body = nil
+		cp.Header.Del("Content-Type")
+	} else {
+		var err error
+		if restore, err = r.keepBodyPosition(); err != nil {
+			return "", err
+		}
+	}
+	if err := DefaultRequestHook(c, &cp); err != nil {
+		restore()
+		return "", err
+	}
+
+	var (
+		body []byte
+		err  error
+	)
+	if rd, ok := cp.Body.(io.Reader); ok && cp.RawRequest.Body != nil {
+		body, err = io.ReadAll(rd)
+	}
+	if rerr := restore(); err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	req := cp.RawRequest
+	var sb strings.Builder
+	sb.WriteString("curl -X ")
+	sb.WriteString(req.Method)
+	sb.WriteString(" ")
+	sb.WriteString(shellQuote(req.URL.String()))
+	sensitive := c.sensitiveHeaders()
+	for _, k := range slices.Sorted(maps.Keys(req.Header)) {
+		for _, v := range req.Header[k] {
+			if slices.ContainsFunc(sensitive, func(s string) bool {
+				return http.CanonicalHeaderKey(s) == k
+			}) {
+				v = "REDACTED"
+			}
+			sb.WriteString(" -H ")
+			sb.WriteString(shellQuote(k + ": " + v))
+		}
+	}
+	if form != nil {
+		for _, p := range form.parts {
+			if p.r == nil {
+				sb.WriteString(" --form-string ")
+				sb.WriteString(shellQuote(p.field + "=" + p.value))
+				continue
+			}
+			sb.WriteString(" -F ")
+			sb.WriteString(shellQuote(p.field + "=@" + p.filename))
+		}
+	}
+	if len(body) > 0 {
+		sb.WriteString(" --data-binary ")
+		sb.WriteString(shellQuote(string(body)))
+	}
+	return sb.String(), nil
+}
+
+// shellQuote quotes s with single quotes for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
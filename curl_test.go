@@ -0,0 +1,94 @@
+package httpxgo
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDumpCurl(t *testing.T) {
+	got, err := New().Post("http://example.test/users", map[string]string{"name": "o'neil"}).
+		SetHeader("Content-Type", "application/json").
+		SetBearerToken("secret").
+		DumpCurl()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `curl -X POST 'http://example.test/users' -H 'Authorization: REDACTED' ` +
+		`-H 'Content-Type: application/json' --data-binary '{"name":"o'\''neil"}'`
+	if got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestDumpCurlKeepsReaderBody(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("server: %v", err)
+			return
+		}
+		b, _ := io.ReadAll(zr)
+		got = append(got, string(b))
+	}))
+	defer srv.Close()
+
+	// Not bound to a client, the default client is used as in Exec
+	req := NewRequest().SetMethod(http.MethodPost).SetURL(srv.URL).
+		SetBody(strings.NewReader("payload")).SetRequestCompression("gzip")
+	if _, err := req.DumpCurl(); err != nil {
+		t.Fatal(err)
+	}
+	res, err := req.Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if len(got) != 1 || got[0] != "payload" {
+		t.Fatalf("server received %q, want payload", got)
+	}
+}
+
+func TestDumpCurlMultipartForm(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("server: %v", err)
+			return
+		}
+		b, _ := io.ReadAll(f)
+		got = append(got, r.FormValue("name")+":"+string(b))
+	}))
+	defer srv.Close()
+
+	newForm := func() *MultipartForm {
+		return NewMultipartForm().AddField("name", "a").
+			AddFile("file", "a.txt", io.MultiReader(strings.NewReader("content")))
+	}
+	want := `curl -X POST '` + srv.URL + `' --form-string 'name=a' -F 'file=@a.txt'`
+	for _, req := range []*Request{
+		New().Post(srv.URL, newForm()),
+		New().Post(srv.URL, nil).SetBodyMultipartStreaming(newForm()),
+	} {
+		dump, err := req.DumpCurl()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dump != want {
+			t.Fatalf("got  %s\nwant %s", dump, want)
+		}
+		res, err := req.Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	if len(got) != 2 || got[0] != "a:content" || got[1] != "a:content" {
+		t.Fatalf("server received %q, want full form after DumpCurl", got)
+	}
+}
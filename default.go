@@ -0,0 +1,50 @@
+package httpxgo
+
+import "sync"
+
+// defaultClient is the shared client used by package level request functions and requests created
+// with [NewRequest]. It's created on first use with [New] so it uses the default transport.
+var defaultClient = sync.OnceValue(New)
+
+// DefaultClient returns the shared client used by the package level [Get], [Post], etc. and by
+// requests created with [NewRequest]. It uses the default transport, configuring it affects every
+// user of the default client.
+func DefaultClient() *Client {
+	return defaultClient()
+}
+
+// Get is http get method of the default client, see [Client.Get].
+func Get(url string) *Request {
+	return defaultClient().Get(url)
+}
+
+// Head is http head method of the default client, see [Client.Head].
+func Head(url string) *Request {
+	return defaultClient().Head(url)
+}
+
+// Post is http post method of the default client, see [Client.Post].
+func Post(url string, body any) *Request {
+	return defaultClient().Post(url, body)
+}
+
+// Put is http put method of the default client, see [Client.Put].
+func Put(url string, body any) *Request {
+	return defaultClient().Put(url, body)
+}
+
+// Patch is http patch method of the default client, see [Client.Patch].
+func Patch(url string, body any) *Request {
+	return defaultClient().Patch(url, body)
+}
+
+// Delete is http delete method of the default client, see [Client.Delete].
+func Delete(url string) *Request {
+	return defaultClient().Delete(url)
+}
+
+// DeleteWithBody is http delete method carrying a body of the default client, see
+// [Client.DeleteWithBody].
+func DeleteWithBody(url string, body any) *Request {
+	return defaultClient().DeleteWithBody(url, body)
+}
@@ -0,0 +1,46 @@
+package httpxgo
+
+import "testing"
+
+func TestDefaultClientRequests(t *testing.T) {
+	srv := echoServer(t)
+	c := New()
+	for _, tt := range []struct {
+		got, want *Request
+	}{
+		{Get(srv.URL), c.Get(srv.URL)},
+		{Head(srv.URL), c.Head(srv.URL)},
+		{Post(srv.URL, "post"), c.Post(srv.URL, "post")},
+		{Put(srv.URL, "put"), c.Put(srv.URL, "put")},
+		{Patch(srv.URL, "patch"), c.Patch(srv.URL, "patch")},
+		{Delete(srv.URL), c.Delete(srv.URL)},
+		{DeleteWithBody(srv.URL, "delete"), c.DeleteWithBody(srv.URL, "delete")},
+	} {
+		if tt.got.client != DefaultClient() {
+			t.Fatalf("%s request is not bound to the default client", tt.got.Method)
+		}
+		if tt.got.Method != tt.want.Method || tt.got.URI != tt.want.URI || tt.got.Body != tt.want.Body {
+			t.Fatalf("request = %s %s %v, want %s %s %v", tt.got.Method, tt.got.URI, tt.got.Body,
+				tt.want.Method, tt.want.URI, tt.want.Body)
+		}
+		got, err := tt.got.Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := tt.want.Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotBody, _ := got.String()
+		wantBody, _ := want.String()
+		got.Body.Close()
+		want.Body.Close()
+		if got.StatusCode != want.StatusCode || gotBody != wantBody {
+			t.Fatalf("%s: response %d %q, want %d %q", tt.got.Method, got.StatusCode, gotBody,
+				want.StatusCode, wantBody)
+		}
+	}
+	if DefaultClient() != DefaultClient() {
+		t.Fatal("default client created more than once")
+	}
+}
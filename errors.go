@@ -0,0 +1,67 @@
+package httpxgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+)
+
+const contentTypeProblemJSON = "application/problem+json"
+
+// HTTPError is returned by [Request.Exec] for unsuccessful responses when error on http error is
+// enabled. Response is still returned along with the error so caller must close the body.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("httpx: unsuccessful response %s", e.Status)
+}
+
+// ContentLengthError is returned when the Content-Length declared by the response exceeds the limit
+// set with [Client.SetMaxDownloadContentLength] or [Request.SetMaxBodySize]. The body is closed
+// without being read.
+type ContentLengthError struct {
+	ContentLength int64
+	Limit         int64
+}
+
+func (e *ContentLengthError) Error() string {
+	return fmt.Sprintf("httpx: content length %d exceeds limit %d", e.ContentLength, e.Limit)
+}
+
+// ProblemDetails is RFC 7807 problem document returned by [Request.Exec] instead of [HTTPError]
+// when the unsuccessful response has "application/problem+json" content type.
+type ProblemDetails struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+func (p *ProblemDetails) Error() string {
+	if p.Detail == "" {
+		return fmt.Sprintf("httpx: problem %d %s", p.Status, p.Title)
+	}
+	return fmt.Sprintf("httpx: problem %d %s: %s", p.Status, p.Title, p.Detail)
+}
+
+// httpError builds the error for unsuccessful response. Problem documents are decoded from the body
+// which marks the body as read.
+func (r *Response) httpError() error {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mt == contentTypeProblemJSON && (!r.IsRead || r.IsReused) {
+		p := &ProblemDetails{}
+		err := json.NewDecoder(r.Body).Decode(p)
+		r.IsRead = true
+		if err == nil {
+			if p.Status == 0 {
+				p.Status = r.StatusCode
+			}
+			return p
+		}
+	}
+	return &HTTPError{StatusCode: r.StatusCode, Status: r.Status}
+}
@@ -0,0 +1,49 @@
+package httpxgo
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProblemDetailsError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/plain" {
+			http.Error(w, "teapot", http.StatusTeapot)
+			return
+		}
+		w.Header().Set("Content-Type", "application/problem+json; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{
+			"type": "https://example.com/probs/out-of-credit",
+			"title": "You do not have enough credit.",
+			"detail": "Your current balance is 30, but that costs 50.",
+			"instance": "/account/12345/msgs/abc"
+		}`))
+	}))
+	defer srv.Close()
+
+	c := New().EnableErrorOnHTTPError()
+	_, err := c.Get(srv.URL).Exec()
+	var p *ProblemDetails
+	if !errors.As(err, &p) {
+		t.Fatalf("err = %v, want ProblemDetails", err)
+	}
+	want := ProblemDetails{
+		Type:     "https://example.com/probs/out-of-credit",
+		Title:    "You do not have enough credit.",
+		Status:   http.StatusForbidden,
+		Detail:   "Your current balance is 30, but that costs 50.",
+		Instance: "/account/12345/msgs/abc",
+	}
+	if *p != want {
+		t.Fatalf("problem = %+v, want %+v", *p, want)
+	}
+
+	_, err = c.Get(srv.URL + "/plain").Exec()
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusTeapot {
+		t.Fatalf("err = %v, want HTTPError for other content types", err)
+	}
+}
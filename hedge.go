@@ -0,0 +1,119 @@
+package httpxgo
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// execHedged sends the request and fires up to [Request.hedgeMax] copies of it, each one after
+// [Request.hedgeDelay] if no response has arrived yet. The first copy to complete wins and the
+// rest are cancelled. If every copy fails the last error is returned.
+func (c *Client) execHedged(r *Request) (*Response, error) {
+	type result struct {
+		req *Request
+		res *Response
+		err error
+		idx int
+	}
+
+	parent := r.ctx
+	if parent == nil {
+		parent = context.Background()
+		r.ctx = parent
+	}
+	// Buffered for every copy so goroutines of losing copies never block.
+	results := make(chan result, r.hedgeMax+1)
+	cancels := make([]context.CancelFunc, 0, r.hedgeMax+1)
+	inflight := 0
+	launch := func() {
+		ctx, cancel := context.WithCancel(parent)
+		cp := r.hedgeCopy(ctx)
+		idx := len(cancels)
+		cancels = append(cancels, cancel)
+		inflight++
+		go func() {
+			res, err := c.exec(cp)
+			results <- result{req: cp, res: res, err: err, idx: idx}
+		}()
+	}
+
+	launch()
+	timer := time.NewTimer(r.hedgeDelay)
+	defer timer.Stop()
+
+	var last result
+	for inflight > 0 {
+		select {
+		case <-timer.C:
+			if len(cancels) <= r.hedgeMax {
+				launch()
+				timer.Reset(r.hedgeDelay)
+			}
+		case last = <-results:
+			inflight--
+			if last.err != nil {
+				cancels[last.idx]()
+				continue
+			}
+			// Cancel the losing copies and release their connections in background.
+			for i, cancel := range cancels {
+				if i != last.idx {
+					cancel()
+				}
+			}
+			go func(n int) {
+				for range n {
+					if loser := <-results; loser.res != nil && loser.res.Body != nil {
+						loser.res.Body.Close()
+					}
+				}
+			}(inflight)
+			last.res.Body = &cancelOnClose{ReadCloser: last.res.Body, cancel: cancels[last.idx]}
+			r.RawRequest = last.req.RawRequest
+			r.tracer = last.req.tracer
+			return last.res, nil
+		}
+	}
+	r.RawRequest = last.req.RawRequest
+	r.tracer = last.req.tracer
+	return last.res, last.err
+}
+
+// hedgeCopy returns a copy of request bound to ctx which can be executed concurrently with the
+// original request.
+func (r *Request) hedgeCopy(ctx context.Context) *Request {
+	cp := *r
+	cp.ctx = ctx
+	cp.Header = r.Header.Clone()
+	cp.Queries = make(url.Values, len(r.Queries))
+	for k, v := range r.Queries {
+		cp.Queries[k] = slices.Clone(v)
+	}
+	return &cp
+}
+
+// isHedged reports whether hedging applies to the request. Hedging requires an idempotent method
+// and a body which can be sent multiple times concurrently.
+func (r *Request) isHedged() bool {
+	if r.hedgeMax <= 0 || r.hedgeDelay <= 0 || !r.isIdempotent() {
+		return false
+	}
+	_, ok := r.Body.(io.Reader)
+	return !ok
+}
+
+// cancelOnClose cancels the context of a response, such as the winning hedged copy, once its body
+// is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
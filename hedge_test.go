@@ -0,0 +1,67 @@
+package httpxgo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgingFastCopyWins(t *testing.T) {
+	var hits, cancelled atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			select {
+			case <-time.After(2 * time.Second):
+			case <-r.Context().Done():
+				cancelled.Add(1)
+				return
+			}
+			w.Write([]byte("slow"))
+			return
+		}
+		w.Write([]byte("fast"))
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	res, err := New().Get(srv.URL).SetHedging(20*time.Millisecond, 2).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := res.String()
+	res.Body.Close()
+	if err != nil || body != "fast" {
+		t.Fatalf("body = %q, err = %v, want the hedged copy", body, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Exec took %v, hedged copy did not win", d)
+	}
+	// Losing copy is cancelled instead of running to completion
+	deadline := time.Now().Add(time.Second)
+	for cancelled.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if cancelled.Load() == 0 {
+		t.Fatal("slow copy was not cancelled")
+	}
+}
+
+func TestHedgingSkippedForPost(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	res, err := New().Post(srv.URL, "x").SetHedging(5*time.Millisecond, 2).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("requests = %d, want 1 for non idempotent method", n)
+	}
+}
@@ -2,6 +2,7 @@ package httpxgo
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"encoding/xml"
@@ -10,11 +11,20 @@ import (
 	"io"
 	"mime"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
+// ErrStopHooks can be returned by a response hook to signal the response is handled, remaining
+// response hooks are skipped and the response is returned without error.
+var ErrStopHooks = errors.New("httpx: stop hooks")
+
 func DefaultRequestHook(c *Client, r *Request) error {
-	if r.Body != nil && r.isPayloadAllowed() {
+	if (r.Body != nil || r.bodyFactory != nil) && r.isPayloadAllowed() {
 		rc, err := handleRequestBody(c, r)
 		if err != nil {
 			return err
@@ -35,6 +45,13 @@ func buildRequest(c *Client, r *Request) error {
 	)
 	body, ok := r.Body.(io.Reader)
 	if ok {
+		// Streaming bodies are wrapped to abort the upload promptly on cancellation, in memory
+		// readers are kept as is so Content-Length and GetBody are set.
+		switch body.(type) {
+		case *bytes.Reader, *bytes.Buffer, *strings.Reader:
+		default:
+			body = &contextReader{Reader: body, ctx: r.ctx}
+		}
 		req, err = http.NewRequestWithContext(r.ctx, r.Method, r.URI, body)
 	} else {
 		req, err = http.NewRequestWithContext(r.ctx, r.Method, r.URI, nil)
@@ -42,7 +59,13 @@ func buildRequest(c *Client, r *Request) error {
 	if err != nil {
 		return err
 	}
-	r.RawRequest = req
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &closeNotifyBody{ReadCloser: req.Body, closed: make(chan struct{})}
+	}
+	c.upgradeScheme(req.URL)
+	c.normalizeTrailingSlash(req.URL)
+	// Host was copied from the URL before the upgrade which may drop the port
+	req.Host = req.URL.Host
 
 	// initiate trace once per request if available
 	if r.IsTrace || c.trace {
@@ -50,6 +73,22 @@ func buildRequest(c *Client, r *Request) error {
 		req = req.WithContext(r.tracer.Tracer(req.Context()))
 	}
 
+	// Capture 103 Early Hints of this attempt
+	r.earlyHints = nil
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code == http.StatusEarlyHints {
+				if r.earlyHints == nil {
+					r.earlyHints = make(http.Header)
+				}
+				for k, v := range header {
+					r.earlyHints[k] = append(r.earlyHints[k], v...)
+				}
+			}
+			return nil
+		},
+	}))
+
 	// Set host, queries and headers
 	req.Header = r.Header
 	req.URL.RawQuery = r.Queries.Encode()
@@ -57,13 +96,16 @@ func buildRequest(c *Client, r *Request) error {
 		req.Host = host
 	}
 
-	r.ctx = req.Context()
+	// r.ctx is kept as is so the traces of this attempt are not inherited by retries
+	r.RawRequest = req
 	return nil
 }
 
 const (
-	contentTypeJSON = "application/json"
-	contentTypeXML  = "application/xml"
+	contentTypeJSON   = "application/json"
+	contentTypeXML    = "application/xml"
+	contentTypeNDJSON = "application/x-ndjson"
+	contentTypeForm   = "application/x-www-form-urlencoded"
 )
 
 // handleRequestBody will handle the automatic encoding of given request body. If the retry is
@@ -71,6 +113,17 @@ const (
 // automatic content type encoding work user must provide correct content type header and
 // content type encoder can be registered to support custom content type.
 func handleRequestBody(c *Client, r *Request) (io.Reader, error) {
+	body, err := encodeRequestBody(c, r)
+	if err != nil || r.compression == "" {
+		return body, err
+	}
+	return compressRequestBody(c, r, body)
+}
+
+func encodeRequestBody(c *Client, r *Request) (io.Reader, error) {
+	if r.bodyFactory != nil {
+		return r.bodyFactory()
+	}
 	switch v := r.Body.(type) {
 	case io.Reader:
 		// Efficient use of bytes.Buffer by converting it into seekable
@@ -90,32 +143,199 @@ func handleRequestBody(c *Client, r *Request) (io.Reader, error) {
 		return strings.NewReader(v), nil
 	case []byte:
 		return bytes.NewReader(v), nil
-	default:
+	case gzipJSONBody:
+		return v.encode()
+	case ndjsonBody:
+		return v.encode()
+	case *MultipartForm:
+		body, ct, err := v.encode()
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Content-Type", ct)
+		return body, nil
+	case multipartStreamBody:
+		body, ct := v.stream()
+		r.Header.Set("Content-Type", ct)
+		return body, nil
+	case url.Values:
+		// Form encoder is registered by default, the content type is inferred from the body
 		if strings.TrimSpace(r.Header.Get("Content-Type")) == "" {
+			r.Header.Set("Content-Type", contentTypeForm)
+		}
+		return encodeBody(c, r, v)
+	default:
+		return encodeBody(c, r, v)
+	}
+}
+
+// compressRequestBody compresses the body with the compressor registered for the request
+// compression and buffers it so it stays replayable.
+func compressRequestBody(c *Client, r *Request, body io.Reader) (io.Reader, error) {
+	// Retries replay the body compressed by the previous attempt
+	if br, ok := body.(*bytes.Reader); ok && br == r.compressed {
+		return br, nil
+	}
+	fn, ok := c.compressors.get(r.compression)
+	if !ok {
+		return nil, fmt.Errorf("compressor not found for %s", r.compression)
+	}
+	var buf bytes.Buffer
+	zw, err := fn(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(zw, body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Encoding", r.compression)
+	r.compressed = bytes.NewReader(buf.Bytes())
+	return r.compressed, nil
+}
+
+// encodeBody encodes v based on the request Content-Type using built-in or registered encoders.
+func encodeBody(c *Client, r *Request, v any) (io.Reader, error) {
+	if strings.TrimSpace(r.Header.Get("Content-Type")) == "" {
+		mt, ok := c.preferredContentType()
+		if !ok {
 			return nil, errors.New("empty content type cannot encode the body")
 		}
-		mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		r.Header.Set("Content-Type", mt)
+	}
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	if mt == contentTypeJSON {
+		b, err := json.Marshal(v)
 		if err != nil {
 			return nil, err
 		}
-		if mt == contentTypeJSON {
-			b, err := json.Marshal(v)
-			if err != nil {
-				return nil, err
-			}
-			return bytes.NewReader(b), nil
+		return bytes.NewReader(b), nil
+	}
+	if mt == contentTypeXML {
+		b, err := xml.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(b), nil
+	}
+	enc, ok := c.contentTypeEncoders.get(mt)
+	if !ok {
+		return nil, fmt.Errorf("content type encoder is not found for content type %s", mt)
+	}
+	return enc(v)
+}
+
+// contextReader aborts reading the request body once the context is cancelled.
+type contextReader struct {
+	io.Reader
+	ctx context.Context
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.Reader.Read(p)
+}
+
+// Close closes the underlying reader if it's an [io.Closer] as transport would have done.
+func (cr *contextReader) Close() error {
+	if c, ok := cr.Reader.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// closeNotifyBody reports when the transport closes the request body. Transport closes the body
+// once it's done writing it, possibly after the response is returned, see [http.RoundTripper].
+type closeNotifyBody struct {
+	io.ReadCloser
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (b *closeNotifyBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { close(b.closed) })
+	return err
+}
+
+// streamingBody tees a non seekable body into a capped buffer while it's being sent so it can be
+// replayed on retries.
+type streamingBody struct {
+	src io.Reader
+	buf bytes.Buffer
+	max int64
+	// overflow is read while transport may still be writing the body
+	overflow atomic.Bool
+}
+
+func (b *streamingBody) Read(p []byte) (int, error) {
+	n, err := b.src.Read(p)
+	if n > 0 && !b.overflow.Load() {
+		if int64(b.buf.Len()+n) > b.max {
+			b.overflow.Store(true)
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
 		}
-		if mt == contentTypeXML {
-			b, err := xml.Marshal(v)
-			if err != nil {
-				return nil, err
+	}
+	return n, err
+}
+
+// replay consumes the remainder of the source which transport did not read and returns the
+// buffered body. It returns error if the body exceeds the buffer size. Transport must be done
+// with the body.
+func (b *streamingBody) replay() (io.ReadSeeker, error) {
+	p := make([]byte, bufferSize)
+	for !b.overflow.Load() {
+		if _, err := b.Read(p); err != nil {
+			if err == io.EOF {
+				break
 			}
-			return bytes.NewReader(b), nil
+			return nil, err
 		}
-		enc, ok := c.contentTypeEncoders.get(mt)
-		if !ok {
-			return nil, fmt.Errorf("content type encoder is not found for content type %s", mt)
+	}
+	if b.overflow.Load() {
+		return nil, errors.New("streaming body exceeds buffer size can not be retried")
+	}
+	return bytes.NewReader(b.buf.Bytes()), nil
+}
+
+// gzipJSONBody is body which is marshaled to JSON and gzip compressed when the request is built.
+type gzipJSONBody struct {
+	v any
+}
+
+func (b gzipJSONBody) encode() (io.Reader, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(b.v); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(buf.Bytes()), nil
+}
+
+// ndjsonBody is body which is encoded as newline delimited JSON when the request is built.
+type ndjsonBody struct {
+	items []any
+}
+
+func (b ndjsonBody) encode() (io.Reader, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, item := range b.items {
+		if err := enc.Encode(item); err != nil {
+			return nil, err
 		}
-		return enc(v)
 	}
+	return bytes.NewReader(buf.Bytes()), nil
 }
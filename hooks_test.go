@@ -0,0 +1,347 @@
+package httpxgo
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpgradeInsecureRequests(t *testing.T) {
+	c := New().UpgradeInsecureRequests("example.test")
+	tests := []struct {
+		url, wantURL, wantHost string
+	}{
+		{"http://example.test:80/x", "https://example.test/x", "example.test"},
+		{"http://example.test/x", "https://example.test/x", "example.test"},
+		{"http://other.test/x", "http://other.test/x", "other.test"},
+	}
+	for _, tt := range tests {
+		r := c.Get(tt.url)
+		if err := DefaultRequestHook(c, r); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.RawRequest.URL.String(); got != tt.wantURL {
+			t.Errorf("%s: url = %s, want %s", tt.url, got, tt.wantURL)
+		}
+		if got := r.RawRequest.Host; got != tt.wantHost {
+			t.Errorf("%s: host = %s, want %s", tt.url, got, tt.wantHost)
+		}
+	}
+}
+
+func TestRequestMetaInHooks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	var seen []any
+	observe := func(v any, ok bool) {
+		if ok {
+			seen = append(seen, v)
+		}
+	}
+	c := New().EnableErrorOnHTTPError().SetErrorHook(func(r *Request, err error) {
+		observe(r.Meta("endpoint"))
+	})
+	res, err := c.Get(srv.URL).SetMeta("endpoint", "listUsers").
+		SetRequestHook(func(_ *Client, r *Request) error {
+			observe(r.Meta("endpoint"))
+			return nil
+		}).
+		SetResponseHook(func(_ *Client, res *Response) error {
+			observe(res.Meta("endpoint"))
+			return nil
+		}).
+		Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	observe(res.Meta("endpoint"))
+	if len(seen) != 3 || seen[0] != "listUsers" || seen[1] != "listUsers" || seen[2] != "listUsers" {
+		t.Fatalf("observed %v, want the label in request and response hooks and the response", seen)
+	}
+
+	seen = nil
+	if _, err := c.Get(srv.URL+"/fail").SetMeta("endpoint", "fail").Exec(); err == nil {
+		t.Fatal("want http error")
+	}
+	if len(seen) != 1 || seen[0] != "fail" {
+		t.Fatalf("error hook observed %v, want the label", seen)
+	}
+	if _, ok := NewRequest().Meta("endpoint"); ok {
+		t.Fatal("request without metadata reported a value")
+	}
+}
+
+func TestSetHeaderIfAbsent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Accept")))
+	}))
+	defer srv.Close()
+
+	defaultAccept := func(_ *Client, r *Request) error {
+		r.SetHeaderIfAbsent("Accept", "application/json")
+		return nil
+	}
+	for set, want := range map[string]string{"": "application/json", "text/csv": "text/csv"} {
+		req := New().Get(srv.URL).SetRequestHook(defaultAccept)
+		if set != "" {
+			req.SetHeader("Accept", set)
+		}
+		res, err := req.Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := res.String()
+		res.Body.Close()
+		if got != want {
+			t.Errorf("Accept set to %q: sent %q, want %q", set, got, want)
+		}
+	}
+}
+
+func TestEncoderPreference(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s", r.Header.Get("Content-Type"), bytes.TrimSpace(b))
+	}))
+	defer srv.Close()
+
+	type user struct {
+		XMLName xml.Name `json:"-" xml:"user"`
+		Name    string   `json:"name" xml:"name"`
+	}
+	custom := func(any) (io.Reader, error) { return strings.NewReader("custom"), nil }
+	tests := []struct {
+		prefs  []string
+		header string
+		want   string
+	}{
+		{[]string{"application/yaml", "application/xml", "application/json"}, "",
+			"application/xml <user><name>a</name></user>"},
+		{[]string{"application/json", "application/xml"}, "", `application/json {"name":"a"}`},
+		{[]string{"text/custom", "application/json"}, "", "text/custom custom"},
+		// Explicit Content-Type wins over the preference
+		{[]string{"application/xml"}, "application/json", `application/json {"name":"a"}`},
+	}
+	for _, tt := range tests {
+		c := New().SetContentTypeEncoder("text/custom", custom).SetEncoderPreference(tt.prefs)
+		req := c.Post(srv.URL, user{Name: "a"})
+		if tt.header != "" {
+			req.SetHeader("Content-Type", tt.header)
+		}
+		res, err := req.Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := res.String()
+		res.Body.Close()
+		if got != tt.want {
+			t.Errorf("preference %v: sent %q, want %q", tt.prefs, got, tt.want)
+		}
+	}
+
+	if _, err := New().SetEncoderPreference([]string{"application/yaml"}).
+		Post(srv.URL, user{Name: "a"}).Exec(); err == nil {
+		t.Error("want error without an available encoder")
+	}
+}
+
+func TestSetHeadersFromHTTPHeader(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%q %q", r.Header.Values("Accept"), r.Header.Values("X-Trace"))
+	}))
+	defer srv.Close()
+
+	h := http.Header{}
+	h.Add("Accept", "application/json")
+	h.Add("Accept", "text/plain")
+	h.Set("x-trace", "b")
+	res, err := New().Get(srv.URL).SetHeader("X-Trace", "a").SetHeadersFromHTTPHeader(h).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	got, _ := res.String()
+	if want := `["application/json" "text/plain"] ["a" "b"]`; got != want {
+		t.Fatalf("server received %s, want %s", got, want)
+	}
+}
+
+func TestErrorHook(t *testing.T) {
+	var observed []error
+	hook := func(r *Request, err error) {
+		if r == nil {
+			t.Error("error hook called without request")
+		}
+		observed = append(observed, err)
+	}
+
+	// Transport error, nothing listens on the closed server
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	c := New().SetErrorHook(hook)
+	_, err := c.Get(srv.URL).Exec()
+	if err == nil || len(observed) != 1 || observed[0] != err {
+		t.Fatalf("transport error: observed %v, Exec returned %v", observed, err)
+	}
+
+	// Circuit breaker open
+	observed = nil
+	cb := NewCircuitBreaker(BreakerConfig{FailureThreshold: 1, Timeout: time.Hour})
+	cb.Execute(nil, errors.New("down"))
+	_, err = New().SetCircuitBreaker(cb).SetErrorHook(hook).Get("http://example.test").Exec()
+	if !errors.Is(err, ErrCircuitBreakerOpen) || len(observed) != 1 || observed[0] != err {
+		t.Fatalf("breaker open: observed %v, Exec returned %v", observed, err)
+	}
+
+	// Successful requests don't call the hook
+	observed = nil
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ok.Close()
+	res, err := c.Get(ok.URL).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if len(observed) != 0 {
+		t.Fatalf("observed %v for a successful request", observed)
+	}
+}
+
+func TestStopHooks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	var ran []int
+	hook := func(n int, err error) ResponseHook {
+		return func(*Client, *Response) error {
+			ran = append(ran, n)
+			return err
+		}
+	}
+	res, err := New().Get(srv.URL).
+		SetResponseHook(hook(1, nil)).
+		SetResponseHook(hook(2, fmt.Errorf("handled: %w", ErrStopHooks))).
+		SetResponseHook(hook(3, nil)).
+		Exec()
+	if err != nil {
+		t.Fatalf("ErrStopHooks treated as failure: %v", err)
+	}
+	res.Body.Close()
+	if len(ran) != 2 || ran[0] != 1 || ran[1] != 2 {
+		t.Fatalf("ran hooks %v, want [1 2] with the rest skipped", ran)
+	}
+}
+
+func TestResponseHooks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	var ran []string
+	reqHook := func(name string) RequestHook {
+		return func(*Client, *Request) error {
+			ran = append(ran, name)
+			return nil
+		}
+	}
+	respHook := func(name string, err error) ResponseHook {
+		return func(*Client, *Response) error {
+			ran = append(ran, name)
+			return err
+		}
+	}
+
+	res, err := New().Get(srv.URL).
+		SetRequestHook(reqHook("req1")).SetRequestHook(reqHook("req2")).
+		SetResponseHook(respHook("res1", nil)).SetResponseHook(respHook("res2", nil)).
+		Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if want := []string{"req1", "req2", "res1", "res2"}; !slices.Equal(ran, want) {
+		t.Fatalf("hooks ran in order %v, want %v", ran, want)
+	}
+
+	// First failing hook is returned and stops the rest
+	ran = nil
+	errHook := errors.New("hook failed")
+	_, err = New().Get(srv.URL).
+		SetResponseHook(respHook("res1", errHook)).SetResponseHook(respHook("res2", nil)).
+		Exec()
+	if !errors.Is(err, errHook) {
+		t.Fatalf("err = %v, want the hook error", err)
+	}
+	if want := []string{"res1"}; !slices.Equal(ran, want) {
+		t.Fatalf("hooks ran %v, want %v", ran, want)
+	}
+}
+
+func TestFormValuesBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s", r.Header.Get("Content-Type"), b)
+	}))
+	defer srv.Close()
+
+	form := url.Values{"name": {"httpx go"}, "tag": {"a", "b"}}
+	for _, tt := range []struct {
+		contentType, want string
+	}{
+		{"", "application/x-www-form-urlencoded name=httpx+go&tag=a&tag=b"},
+		{"application/json", `application/json {"name":["httpx go"],"tag":["a","b"]}`},
+	} {
+		req := New().Post(srv.URL, form)
+		if tt.contentType != "" {
+			req.SetHeader("Content-Type", tt.contentType)
+		}
+		res, err := req.Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := res.String()
+		res.Body.Close()
+		if strings.TrimSpace(got) != tt.want {
+			t.Errorf("Content-Type %q: server got %q, want %q", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestFormValuesBodyRetry(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, r.Header.Get("Content-Type")+" "+string(b))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	form := url.Values{"q": {"a&b=c"}, "page": {"2"}}
+	res, err := New().Post(srv.URL, form).
+		SetHeader("Content-Type", "application/x-www-form-urlencoded").
+		SetRetry(&Retry{Count: 1, Wait: time.Millisecond}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	want := "application/x-www-form-urlencoded page=2&q=a%26b%3Dc"
+	if len(bodies) != 2 || bodies[0] != want || bodies[1] != want {
+		t.Fatalf("server got %q, want %q on both attempts", bodies, want)
+	}
+}
@@ -0,0 +1,120 @@
+// Package httpxgotest provides fluent assertions over httpx-go requests for use in tests. It's a
+// separate package so the main package doesn't depend on testing.
+//
+//	httpxgotest.Expect(t, c.Get(srv.URL)).
+//		Status(http.StatusOK).
+//		HeaderContains("Content-Type", "json").
+//		JSONField("data.id", 42)
+package httpxgotest
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	httpxgo "github.com/jshk00/httpx-go"
+)
+
+// Expectation holds the executed response for chaining assertions. Failed assertions are reported
+// with [testing.TB.Errorf] so every assertion in the chain is checked.
+type Expectation struct {
+	t    testing.TB
+	res  *httpxgo.Response
+	body []byte
+}
+
+// Expect executes r and returns expectation over its response. Failure to execute the request or
+// read the body is fatal.
+func Expect(t testing.TB, r *httpxgo.Request) *Expectation {
+	t.Helper()
+	res, err := r.Exec()
+	if err != nil {
+		t.Fatalf("httpxgotest: executing request: %v", err)
+	}
+	defer res.Body.Close()
+	body, err := res.Bytes()
+	if err != nil {
+		t.Fatalf("httpxgotest: reading body: %v", err)
+	}
+	return &Expectation{t: t, res: res, body: body}
+}
+
+// Response returns the executed response, its body is already read and available via Body.
+func (e *Expectation) Response() *httpxgo.Response {
+	return e.res
+}
+
+// Body returns the response body.
+func (e *Expectation) Body() []byte {
+	return e.body
+}
+
+// Status asserts the response status code.
+func (e *Expectation) Status(code int) *Expectation {
+	e.t.Helper()
+	if e.res.StatusCode != code {
+		e.t.Errorf("httpxgotest: status = %d, want %d", e.res.StatusCode, code)
+	}
+	return e
+}
+
+// HeaderContains asserts the response header k contains substr.
+func (e *Expectation) HeaderContains(k, substr string) *Expectation {
+	e.t.Helper()
+	if v := e.res.Header.Get(k); !strings.Contains(v, substr) {
+		e.t.Errorf("httpxgotest: header %s = %q, want it to contain %q", k, v, substr)
+	}
+	return e
+}
+
+// JSONField asserts the value at dotted path of the JSON body equals want, e.g. "data.items.0.id".
+// Values are compared after JSON round trip so want of 42 matches JSON number 42.
+func (e *Expectation) JSONField(path string, want any) *Expectation {
+	e.t.Helper()
+	var doc any
+	if err := json.Unmarshal(e.body, &doc); err != nil {
+		e.t.Errorf("httpxgotest: body is not JSON: %v", err)
+		return e
+	}
+	got, ok := lookup(doc, path)
+	if !ok {
+		e.t.Errorf("httpxgotest: JSON field %s not found", path)
+		return e
+	}
+	b, err := json.Marshal(want)
+	if err != nil {
+		e.t.Errorf("httpxgotest: marshaling expected value: %v", err)
+		return e
+	}
+	var norm any
+	_ = json.Unmarshal(b, &norm)
+	if !reflect.DeepEqual(got, norm) {
+		e.t.Errorf("httpxgotest: JSON field %s = %v, want %v", path, got, want)
+	}
+	return e
+}
+
+// lookup resolves dotted path in decoded JSON document, numeric segments index arrays.
+func lookup(doc any, path string) (any, bool) {
+	for seg := range strings.SplitSeq(path, ".") {
+		switch v := doc.(type) {
+		case map[string]any:
+			next, ok := v[seg]
+			if !ok {
+				return nil, false
+			}
+			doc = next
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
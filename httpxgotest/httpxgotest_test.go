@@ -0,0 +1,137 @@
+package httpxgotest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	httpxgo "github.com/jshk00/httpx-go"
+)
+
+// recorder records failures instead of failing the test, Fatalf stops the goroutine like
+// testing.T does.
+type recorder struct {
+	testing.TB
+	errors []string
+	fatal  bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+	r.fatal = true
+	runtime.Goexit()
+}
+
+// record runs fn with a recorder on its own goroutine so Fatalf can stop it.
+func record(t *testing.T, fn func(tb testing.TB)) *recorder {
+	rec := &recorder{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(rec)
+	}()
+	<-done
+	return rec
+}
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"data":{"id":42,"items":[{"name":"a"},{"name":"b"}]}}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestExpectPasses(t *testing.T) {
+	srv := newServer(t)
+	e := Expect(t, httpxgo.New().Get(srv.URL)).
+		Status(http.StatusCreated).
+		HeaderContains("Content-Type", "json").
+		JSONField("data.id", 42).
+		JSONField("data.items.1.name", "b").
+		JSONField("data.items", []map[string]string{{"name": "a"}, {"name": "b"}})
+	if e.Response().StatusCode != http.StatusCreated {
+		t.Fatalf("Response status = %d", e.Response().StatusCode)
+	}
+	if !strings.HasPrefix(string(e.Body()), `{"data"`) {
+		t.Fatalf("Body = %q", e.Body())
+	}
+}
+
+func TestExpectFailures(t *testing.T) {
+	srv := newServer(t)
+	tests := []struct {
+		name   string
+		assert func(*Expectation)
+		want   string
+	}{
+		{"status", func(e *Expectation) { e.Status(http.StatusOK) }, "status = 201, want 200"},
+		{
+			"header",
+			func(e *Expectation) { e.HeaderContains("Content-Type", "xml") },
+			"want it to contain",
+		},
+		{"field value", func(e *Expectation) { e.JSONField("data.id", 7) }, "data.id = 42, want 7"},
+		{"missing field", func(e *Expectation) { e.JSONField("data.items.5", 1) }, "not found"},
+		{"scalar segment", func(e *Expectation) { e.JSONField("data.id.x", 1) }, "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := record(t, func(tb testing.TB) {
+				tt.assert(Expect(tb, httpxgo.New().Get(srv.URL)))
+			})
+			if rec.fatal || len(rec.errors) != 1 || !strings.Contains(rec.errors[0], tt.want) {
+				t.Fatalf("errors = %q, want one containing %q", rec.errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpectChainReportsEveryFailure(t *testing.T) {
+	srv := newServer(t)
+	rec := record(t, func(tb testing.TB) {
+		Expect(tb, httpxgo.New().Get(srv.URL)).Status(http.StatusOK).JSONField("data.id", 1)
+	})
+	if len(rec.errors) != 2 {
+		t.Fatalf("errors = %q, want both assertions reported", rec.errors)
+	}
+}
+
+func TestExpectNotJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "plain")
+	}))
+	defer srv.Close()
+
+	rec := record(t, func(tb testing.TB) {
+		Expect(tb, httpxgo.New().Get(srv.URL)).JSONField("id", 1)
+	})
+	if len(rec.errors) != 1 || !strings.Contains(rec.errors[0], "not JSON") {
+		t.Fatalf("errors = %q, want body is not JSON", rec.errors)
+	}
+}
+
+func TestExpectExecFailureIsFatal(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	rec := record(t, func(tb testing.TB) {
+		Expect(tb, httpxgo.New().Get(url)).Status(http.StatusOK)
+	})
+	if !rec.fatal || len(rec.errors) != 1 || !strings.Contains(rec.errors[0], "executing request") {
+		t.Fatalf("errors = %q, fatal = %v, want fatal execution failure", rec.errors, rec.fatal)
+	}
+}
@@ -0,0 +1,113 @@
+package httpxgo
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+)
+
+// MultipartForm is multipart/form-data body made of fields and files. Passed to [Request.SetBody]
+// it's buffered in memory so the request can be retried, the Content-Type header with boundary is
+// set automatically. Use [Request.SetBodyMultipartStreaming] for large files.
+type MultipartForm struct {
+	parts []multipartPart
+}
+
+type multipartPart struct {
+	field    string
+	value    string
+	filename string
+	r        io.Reader
+}
+
+func NewMultipartForm() *MultipartForm {
+	return &MultipartForm{}
+}
+
+// AddField adds a form field.
+func (f *MultipartForm) AddField(name, value string) *MultipartForm {
+	f.parts = append(f.parts, multipartPart{field: name, value: value})
+	return f
+}
+
+// AddFile adds a file read from r under the form field.
+func (f *MultipartForm) AddFile(field, filename string, r io.Reader) *MultipartForm {
+	f.parts = append(f.parts, multipartPart{field: field, filename: filename, r: r})
+	return f
+}
+
+// keepPosition records the read position of the files so the form can be encoded without
+// consuming them, the returned func restores the positions. It returns [ErrBodyNotReplayable] if a
+// file is not an [io.Seeker].
+func (f *MultipartForm) keepPosition() (func() error, error) {
+	var restores []func() error
+	for _, p := range f.parts {
+		if p.r == nil {
+			continue
+		}
+		s, ok := p.r.(io.Seeker)
+		if !ok {
+			return nil, ErrBodyNotReplayable
+		}
+		restore, err := keepPosition(s)
+		if err != nil {
+			return nil, err
+		}
+		restores = append(restores, restore)
+	}
+	return func() error {
+		for _, restore := range restores {
+			if err := restore(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// writeTo writes all the parts and the closing boundary to mw.
+func (f *MultipartForm) writeTo(mw *multipart.Writer) error {
+	for _, p := range f.parts {
+		if p.r == nil {
+			if err := mw.WriteField(p.field, p.value); err != nil {
+				return err
+			}
+			continue
+		}
+		w, err := mw.CreateFormFile(p.field, p.filename)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, p.r); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// encode buffers the whole form in memory so the body is replayable on retries. It returns the
+// content type carrying the boundary.
+func (f *MultipartForm) encode() (io.Reader, string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if err := f.writeTo(mw); err != nil {
+		return nil, "", err
+	}
+	return bytes.NewReader(buf.Bytes()), mw.FormDataContentType(), nil
+}
+
+// multipartStreamBody is multipart form streamed through a pipe while transport reads it.
+type multipartStreamBody struct {
+	form *MultipartForm
+}
+
+// stream starts writing the form in background and returns the reading end of the pipe along with
+// the content type carrying the boundary. Write errors are propagated to the reader.
+func (b multipartStreamBody) stream() (io.Reader, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(b.form.writeTo(mw))
+	}()
+	return pr, mw.FormDataContentType()
+}
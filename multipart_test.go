@@ -0,0 +1,162 @@
+package httpxgo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMultipartStreamingLargeFile(t *testing.T) {
+	const size = 8 << 20
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			t.Errorf("server: %v", err)
+			return
+		}
+		p, err := mr.NextPart()
+		if err != nil {
+			t.Errorf("server: %v", err)
+			return
+		}
+		n, _ := io.Copy(io.Discard, p)
+		if n != size {
+			t.Errorf("received %d bytes, want %d", n, size)
+		}
+	}))
+	defer srv.Close()
+
+	form := NewMultipartForm().AddFile("file", "big.bin", io.LimitReader(zeroReader{}, size))
+	res, err := New().Post(srv.URL, nil).SetBodyMultipartStreaming(form).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+}
+
+func TestMultipartStreamingNotRetried(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		io.Copy(io.Discard, r.Body)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	form := NewMultipartForm().AddFile("file", "a.txt", bytes.NewReader([]byte("content")))
+	res, err := New().Post(srv.URL, nil).SetBodyMultipartStreaming(form).
+		SetRetry(&Retry{Count: 3, Wait: time.Millisecond}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if requests != 1 {
+		t.Fatalf("requests = %d, want 1", requests)
+	}
+	body, err := res.String()
+	if err != nil || body != "unavailable\n" {
+		t.Fatalf("body = %q, err = %v, want the first response", body, err)
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestFinalBodyKeepsMultipartFiles(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("server: %v", err)
+			return
+		}
+		b, _ := io.ReadAll(f)
+		got = append(got, string(b))
+	}))
+	defer srv.Close()
+
+	form := NewMultipartForm().AddField("name", "a").
+		AddFile("file", "a.txt", strings.NewReader("content"))
+	req := New().Post(srv.URL, form)
+	b, err := req.FinalBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "content") {
+		t.Fatalf("final body %q does not contain the file", b)
+	}
+	res, err := req.Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if len(got) != 1 || got[0] != "content" {
+		t.Fatalf("server received %q, want content", got)
+	}
+
+	// Files which can not be rewound are not consumed
+	form = NewMultipartForm().AddFile("file", "a.txt", io.MultiReader(strings.NewReader("stream")))
+	if _, err := New().Post(srv.URL, form).FinalBody(); err != ErrBodyNotReplayable {
+		t.Fatalf("err = %v, want ErrBodyNotReplayable", err)
+	}
+	_, err = New().Post(srv.URL, nil).SetBodyMultipartStreaming(form).FinalBody()
+	if err != ErrBodyNotReplayable {
+		t.Fatalf("streaming form: err = %v, want ErrBodyNotReplayable", err)
+	}
+	res, err = New().Post(srv.URL, form).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if len(got) != 2 || got[1] != "stream" {
+		t.Fatalf("server received %q, want stream", got)
+	}
+}
+
+func TestMultipartFormUpload(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("server: %v", err)
+			return
+		}
+		f, fh, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("server: %v", err)
+			return
+		}
+		defer f.Close()
+		content, _ := io.ReadAll(f)
+		// First attempt fails so the buffered form is replayed
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprintf(w, "%s %s %s %s", r.FormValue("name"), r.FormValue("tag"), fh.Filename, content)
+	}))
+	defer srv.Close()
+
+	form := NewMultipartForm().AddField("name", "httpx").AddField("tag", "go").
+		AddFile("file", "a.txt", strings.NewReader("file content"))
+	res, err := New().Post(srv.URL, form).SetRetry(&Retry{Count: 1, Wait: time.Millisecond}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	got, err := res.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "httpx go a.txt file content"; got != want || requests != 2 {
+		t.Fatalf("server parsed %q after %d requests, want %q after a retry", got, requests, want)
+	}
+}
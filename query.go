@@ -0,0 +1,110 @@
+package httpxgo
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// SetQueryStruct sets the query parameters from the exported fields of struct v, which may be a
+// pointer. Parameter names are taken from the `url:"name"` tag or the field name, fields tagged
+// `url:"-"` are skipped and zero values are skipped with `url:",omitempty"`. Slices are expanded
+// into repeated parameters, nil pointers are skipped and nested structs are flattened as
+// "parent[child]". Values implementing [encoding.TextMarshaler] are encoded with it. Parameters
+// already set with the same name are replaced.
+func (r *Request) SetQueryStruct(v any) *Request {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return r
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return r
+	}
+	vals := make(url.Values)
+	queryStruct(vals, "", rv)
+	for k, vs := range vals {
+		r.Queries[k] = vs
+	}
+	return r
+}
+
+func queryStruct(vals url.Values, prefix string, rv reflect.Value) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag := sf.Tag.Get("url")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		omitempty := opts == "omitempty"
+
+		fv := rv.Field(i)
+		if omitempty && fv.IsZero() {
+			continue
+		}
+		for fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				break
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Pointer {
+			continue
+		}
+
+		// Embedded structs without a name are flattened into the parent
+		if sf.Anonymous && name == "" && fv.Kind() == reflect.Struct && !isTextMarshaler(fv) {
+			queryStruct(vals, prefix, fv)
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if prefix != "" {
+			name = prefix + "[" + name + "]"
+		}
+
+		switch {
+		case isTextMarshaler(fv):
+			vals.Add(name, queryValue(fv))
+		case fv.Kind() == reflect.Struct:
+			queryStruct(vals, name, fv)
+		case fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array:
+			for j := 0; j < fv.Len(); j++ {
+				vals.Add(name, queryValue(fv.Index(j)))
+			}
+		default:
+			vals.Add(name, queryValue(fv))
+		}
+	}
+}
+
+func isTextMarshaler(v reflect.Value) bool {
+	_, ok := v.Interface().(encoding.TextMarshaler)
+	return ok
+}
+
+// queryValue formats a single query value.
+func queryValue(v reflect.Value) string {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		if b, err := m.MarshalText(); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
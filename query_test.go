@@ -0,0 +1,58 @@
+package httpxgo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetQueryStruct(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer srv.Close()
+
+	type page struct {
+		Size int `url:"size"`
+	}
+	type filter struct {
+		Query   string     `url:"q"`
+		Tags    []string   `url:"tag"`
+		Limit   int        `url:"limit,omitempty"`
+		Offset  int        `url:"offset"`
+		Owner   *string    `url:"owner"`
+		Since   *time.Time `url:"since,omitempty"`
+		Page    page       `url:"page"`
+		Secret  string     `url:"-"`
+		private string
+	}
+	since := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tt := range []struct {
+		name string
+		v    any
+		want string
+	}{
+		{
+			"omitempty and nil pointer",
+			filter{Query: "go", Tags: []string{"a", "b"}, Secret: "s", private: "p"},
+			"keep=1&offset=0&page%5Bsize%5D=0&q=go&tag=a&tag=b",
+		},
+		{
+			"pointers",
+			&filter{Limit: 10, Since: &since, Page: page{Size: 50}},
+			"keep=1&limit=10&offset=0&page%5Bsize%5D=50&q=&since=2024-01-02T03%3A04%3A05Z",
+		},
+		{"nil struct pointer", (*filter)(nil), "keep=1"},
+	} {
+		res, err := New().Get(srv.URL).SetQuery("keep", "1").SetQueryStruct(tt.v).Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := res.String()
+		res.Body.Close()
+		if got != tt.want {
+			t.Errorf("%s: query = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
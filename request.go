@@ -1,7 +1,9 @@
 package httpxgo
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
 	"io"
 	"net/http"
@@ -17,6 +19,23 @@ type Request struct {
 	ctx                     context.Context
 	cookie                  *http.Cookie
 	retry                   *Retry
+	hedgeDelay              time.Duration
+	hedgeMax                int
+	noProxy                 bool
+	certPins                [][]byte
+	skipBreaker             bool
+	meta                    map[string]any
+	earlyHints              http.Header
+	decompressors           map[string]DecompressFn
+	bodyFactory             func() (io.Reader, error)
+	timeout                 time.Duration
+	deadline                time.Duration
+	successCond             func(*Response) bool
+	compression             string
+	compressed              *bytes.Reader
+	maxBodySize             int64
+	ctEncodings             map[string]string
+	retryIf                 []RetryPredicate
 	URI                     string
 	Queries                 url.Values
 	Header                  http.Header
@@ -24,12 +43,15 @@ type Request struct {
 	Method                  string
 	IsTrace                 bool
 	IsRetry                 bool
+	ErrorOnHTTPError        bool
 	Attempt                 int
 	AllowGetPayload         bool
-	AlloweDeletePayload     bool
+	AllowDeletePayload      bool
 	AllowNonIdempotentRetry bool
 	RawRequest              *http.Request
 	TotalTime               time.Duration
+	// Deprecated: Use AllowDeletePayload, setting either field allows DELETE payload.
+	AlloweDeletePayload bool
 }
 
 func NewRequest() *Request {
@@ -59,6 +81,34 @@ func (r *Request) EnableTrace() *Request {
 	return r
 }
 
+// EnableErrorOnHTTPError makes [Request.Exec] return an error for unsuccessful responses, see
+// [HTTPError] and [ProblemDetails].
+func (r *Request) EnableErrorOnHTTPError() *Request {
+	r.ErrorOnHTTPError = true
+	return r
+}
+
+// SetNoProxy sends this request directly, bypassing the proxy configured on the client transport.
+func (r *Request) SetNoProxy() *Request {
+	r.noProxy = true
+	return r
+}
+
+// SetCertPinning accepts the TLS connection only if the SHA-256 fingerprint of the leaf certificate
+// matches one of fingerprints. Pinning is verified during handshake so nothing is sent to a peer
+// with non-matching certificate.
+func (r *Request) SetCertPinning(fingerprints [][]byte) *Request {
+	r.certPins = fingerprints
+	return r
+}
+
+// SkipCircuitBreaker excludes the request from the client circuit breaker, it's neither rejected
+// by an open breaker nor recorded by it. Useful for health check pings.
+func (r *Request) SkipCircuitBreaker() *Request {
+	r.skipBreaker = true
+	return r
+}
+
 func (r *Request) SetRetry(retry *Retry) *Request {
 	if retry == nil {
 		retry = NewRetry()
@@ -68,11 +118,120 @@ func (r *Request) SetRetry(retry *Retry) *Request {
 	return r
 }
 
+// SetTimeout sets a deadline of d for the whole [Request.Exec] including retries, the wait between
+// them and reading the response body. It's applied on top of the context set with
+// [Request.WithContext] or the background context, whichever deadline is earlier wins. The context
+// is released once the response body is closed or when Exec returns without a response.
+func (r *Request) SetTimeout(d time.Duration) *Request {
+	r.timeout = d
+	return r
+}
+
+// SetDeadline bounds the whole [Request.Exec] including every retry and the backoff between them
+// by d, for callers that don't manage contexts themselves. Like [Request.SetTimeout] it wraps the
+// context set with [Request.WithContext] or the background context, whichever deadline is earlier
+// wins. Retrying stops once the next attempt would start after the deadline, the last response is
+// returned then rather than a context error.
+func (r *Request) SetDeadline(d time.Duration) *Request {
+	r.deadline = d
+	return r
+}
+
+// SetRetryIf retries the request when any of the predicates is true, in addition to the default
+// condition and [Retry.Cond]. Without a retry set by [Request.SetRetry] beforehand it retries up to
+// 3 times with full jitter backoff between 100ms and 3s rather than the [NewRetry] defaults. Like
+// any request with retry enabled, response hooks set with [Request.SetResponseHook] don't run.
+func (r *Request) SetRetryIf(preds ...RetryPredicate) *Request {
+	if !r.IsRetry {
+		r.SetRetry(&Retry{Count: 3, Backoff: NewBackoffWithJitter(0, 0, FullJitter)})
+	}
+	r.retryIf = preds
+	return r
+}
+
+// SetHedging enables hedged requests to cut tail latency. If no response has arrived after delay
+// another copy of the request is fired, up to max additional copies. The first copy to complete
+// wins and the rest are cancelled. Hedging only applies to idempotent methods and is skipped for
+// [io.Reader] bodies since those can not be sent concurrently.
+func (r *Request) SetHedging(delay time.Duration, max int) *Request {
+	r.hedgeDelay = delay
+	r.hedgeMax = max
+	return r
+}
+
 func (r *Request) SetBody(v any) *Request {
 	r.Body = v
 	return r
 }
 
+// SetStreamingBody sets a body which can not be seeked such as generated or encrypted streams. The
+// first attempt tees the body into a buffer capped at maxBuffer bytes so it can be replayed on
+// retries. If the body exceeds maxBuffer it is not replayable and retries are disabled for this
+// request, the result of the first attempt is returned as is. When the server responds before the
+// body is sent, the unsent remainder is buffered for the retry and [Request.Exec] fails with
+// [ErrBodyNotReplayable] if it exceeds maxBuffer.
+func (r *Request) SetStreamingBody(rd io.Reader, maxBuffer int64) *Request {
+	r.Body = &streamingBody{src: rd, max: maxBuffer}
+	return r
+}
+
+// SetBodyJSON sets the body to be marshaled to JSON and sets the Content-Type header.
+func (r *Request) SetBodyJSON(v any) *Request {
+	r.Body = v
+	r.Header.Set("Content-Type", contentTypeJSON)
+	return r
+}
+
+// SetBodyXML sets the body to be marshaled to XML and sets the Content-Type header.
+func (r *Request) SetBodyXML(v any) *Request {
+	r.Body = v
+	r.Header.Set("Content-Type", contentTypeXML)
+	return r
+}
+
+// SetBodyGzipJSON sets the body to be marshaled to JSON and gzip compressed. It sets the
+// Content-Type and Content-Encoding headers, the compressed body is buffered so it can be replayed
+// on retries.
+func (r *Request) SetBodyGzipJSON(v any) *Request {
+	r.Body = gzipJSONBody{v: v}
+	r.Header.Set("Content-Type", contentTypeJSON)
+	r.Header.Set("Content-Encoding", "gzip")
+	return r
+}
+
+// SetBodyNDJSON sets the body to items encoded as newline delimited JSON, one item per line, and
+// sets the Content-Type header. The encoded body is buffered so it can be replayed on retries.
+func (r *Request) SetBodyNDJSON(items []any) *Request {
+	r.Body = ndjsonBody{items: items}
+	r.Header.Set("Content-Type", contentTypeNDJSON)
+	return r
+}
+
+// SetBodyMultipartStreaming sets the form as multipart/form-data body which is streamed while the
+// transport sends it, so large files are never buffered in memory. The Content-Type header with
+// boundary is set automatically. Streamed body is not replayable so the request is not retried,
+// the first response is returned.
+func (r *Request) SetBodyMultipartStreaming(form *MultipartForm) *Request {
+	r.Body = multipartStreamBody{form: form}
+	return r
+}
+
+// SetRequestCompression compresses the encoded request body with the compressor registered for
+// encoding, such as "gzip", and sets the Content-Encoding header. The compressed body is buffered
+// in memory so it can be replayed on retries. See [Client.SetCompressor].
+func (r *Request) SetRequestCompression(encoding string) *Request {
+	r.compression = encoding
+	return r
+}
+
+// SetBodyFactory sets factory called for every attempt to produce a fresh body, enabling retries of
+// non replayable streaming bodies without buffering them. The factory takes precedence over the
+// body set with [Request.SetBody].
+func (r *Request) SetBodyFactory(fn func() (io.Reader, error)) *Request {
+	r.bodyFactory = fn
+	return r
+}
+
 func (r *Request) SetURL(uri string) *Request {
 	r.URI = uri
 	return r
@@ -87,6 +246,26 @@ func (r *Request) SetHeader(k, v string) *Request {
 	return r
 }
 
+// SetHeaderIfAbsent sets the header only if it's not already set, handy for defaults in hooks.
+func (r *Request) SetHeaderIfAbsent(k, v string) *Request {
+	if r.Header.Get(k) == "" {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+// SetBasicAuth sets the Authorization header with the base64 encoded credentials as per RFC 7617.
+func (r *Request) SetBasicAuth(user, pass string) *Request {
+	r.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+pass)))
+	return r
+}
+
+// SetBearerToken sets the Authorization header with the bearer token.
+func (r *Request) SetBearerToken(token string) *Request {
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
 func (r *Request) SetCookies(c *http.Cookie) *Request {
 	r.cookie = c
 	return r
@@ -99,11 +278,29 @@ func (r *Request) SetHeaders(hdrs map[string]string) *Request {
 	return r
 }
 
+// SetHeadersFromHTTPHeader merges h into the request headers keeping repeated values.
+func (r *Request) SetHeadersFromHTTPHeader(h http.Header) *Request {
+	for k, v := range h {
+		for _, vv := range v {
+			r.Header.Add(k, vv)
+		}
+	}
+	return r
+}
+
 func (r *Request) SetQuery(k, v string) *Request {
 	r.Queries.Set(k, v)
 	return r
 }
 
+// SetQueryArray appends values under key, e.g. "?id=1&id=2&id=3". Order of values is preserved.
+func (r *Request) SetQueryArray(k string, values []string) *Request {
+	for _, v := range values {
+		r.Queries.Add(k, v)
+	}
+	return r
+}
+
 func (r *Request) SetQueries(queries map[string]string) *Request {
 	for k, v := range queries {
 		r.SetQuery(k, v)
@@ -111,6 +308,40 @@ func (r *Request) SetQueries(queries map[string]string) *Request {
 	return r
 }
 
+// SetMeta attaches arbitrary metadata such as an endpoint label to the request. Metadata is never
+// sent, it's accessible in hooks through [Request.Meta] and [Response.Meta].
+func (r *Request) SetMeta(k string, v any) *Request {
+	if r.meta == nil {
+		r.meta = make(map[string]any)
+	}
+	r.meta[k] = v
+	return r
+}
+
+// Meta returns the metadata set with [Request.SetMeta].
+func (r *Request) Meta(k string) (any, bool) {
+	v, ok := r.meta[k]
+	return v, ok
+}
+
+// SetDecompressor registers a decompression function for the Content-Encoding of this request's
+// response only, overriding the client decompressor with same key. See [Client.SetDecompressor].
+func (r *Request) SetDecompressor(key string, fn DecompressFn) *Request {
+	if r.decompressors == nil {
+		r.decompressors = make(map[string]DecompressFn)
+	}
+	r.decompressors[key] = fn
+	return r
+}
+
+// TreatContentTypeAsEncoding decompresses responses without Content-Encoding header whose media
+// type is in m, using the decompressor registered for the mapped key, e.g.
+// {"application/gzip": "gzip"}.
+func (r *Request) TreatContentTypeAsEncoding(m map[string]string) *Request {
+	r.ctEncodings = m
+	return r
+}
+
 func (r *Request) SetRequestHook(hook RequestHook) *Request {
 	r.reqHooks = append(r.reqHooks, hook)
 	return r
@@ -121,12 +352,30 @@ func (r *Request) SetResponseHook(hook ResponseHook) *Request {
 	return r
 }
 
+// SetMaxBodySize limits the response body of this request to n bytes, overriding the limits set
+// with [Client.SetMaxBodySize] and [Client.SetMaxDownloadContentLength], e.g. for a known large
+// download. Responses declaring a larger Content-Length fail with [ContentLengthError], reading
+// more than n bytes of the body fails with [ErrBodyTooLarge]. A negative n disables the limits for
+// this request.
+func (r *Request) SetMaxBodySize(n int64) *Request {
+	r.maxBodySize = n
+	return r
+}
+
+// SetSuccessCondition overrides the 2xx range used by [Response.Success] and by the error on
+// http error handling to decide whether the response is successful.
+func (r *Request) SetSuccessCondition(fn func(*Response) bool) *Request {
+	r.successCond = fn
+	return r
+}
+
 func (r *Request) SetAllowGetPayload(b bool) *Request {
 	r.AllowGetPayload = b
 	return r
 }
 
 func (r *Request) SetAllowDeletePayload(b bool) *Request {
+	r.AllowDeletePayload = b
 	r.AlloweDeletePayload = b
 	return r
 }
@@ -136,6 +385,169 @@ func (r *Request) SetAllowNonIdempotentRetry(b bool) *Request {
 	return r
 }
 
+// canReplay reports whether the body can be sent again without touching it, the transport may
+// still be writing the body of the last attempt.
+func (r *Request) canReplay() bool {
+	if r.bodyFactory != nil || !r.isPayloadAllowed() {
+		return true
+	}
+	switch b := r.Body.(type) {
+	case *streamingBody:
+		return !b.overflow.Load()
+	case io.Reader:
+		_, ok := b.(io.Seeker)
+		return ok
+	}
+	return true
+}
+
+// rewindBody waits until the transport is done with the body of the last attempt and prepares it
+// to be sent again. The response of the attempt must be closed beforehand, otherwise transport may
+// keep writing the body. It returns [ErrBodyNotReplayable] if the body can not be replayed.
+func (r *Request) rewindBody() error {
+	if req := r.RawRequest; req != nil {
+		if b, ok := req.Body.(*closeNotifyBody); ok {
+			select {
+			case <-b.closed:
+			case <-r.Context().Done():
+				return r.Context().Err()
+			}
+		}
+	}
+	if !r.replayable() {
+		return ErrBodyNotReplayable
+	}
+	return nil
+}
+
+// replayable prepares the request body to be sent again, it reports false if the body can not be
+// replayed. Transport must be done with the body, see [Request.rewindBody].
+func (r *Request) replayable() bool {
+	if r.bodyFactory != nil || !r.isPayloadAllowed() {
+		return true
+	}
+	switch b := r.Body.(type) {
+	case *streamingBody:
+		rd, err := b.replay()
+		if err != nil {
+			return false
+		}
+		r.Body = rd
+	case io.Reader:
+		s, ok := b.(io.Seeker)
+		if !ok {
+			return false
+		}
+		if _, err := s.Seek(0, io.SeekStart); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrBodyNotReplayable is returned by [Request.FinalBody] for streaming bodies which can not be
+// read without consuming them, and by [Request.Exec] when a retry can not replay the body.
+var ErrBodyNotReplayable = errors.New("httpx: body is not replayable")
+
+// FinalBody returns the exact body bytes which are sent, after encoding and compression. Inside
+// request hooks which run after [DefaultRequestHook] it returns the body of the built request,
+// otherwise the body is encoded the same way [Request.Exec] does without modifying the request.
+// It returns [ErrBodyNotReplayable] for streaming bodies, including multipart forms with files
+// which are not [io.Seeker], and nil for requests without a body.
+func (r *Request) FinalBody() ([]byte, error) {
+	if req := r.RawRequest; req != nil {
+		if req.Body == nil || req.Body == http.NoBody {
+			return nil, nil
+		}
+		if req.GetBody == nil {
+			return nil, ErrBodyNotReplayable
+		}
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+
+	if (r.Body == nil && r.bodyFactory == nil) || !r.isPayloadAllowed() {
+		return nil, nil
+	}
+	switch b := r.Body.(type) {
+	case multipartStreamBody:
+		return nil, ErrBodyNotReplayable
+	case io.Reader:
+		if _, ok := b.(io.Seeker); !ok {
+			if _, ok := b.(*bytes.Buffer); !ok {
+				return nil, ErrBodyNotReplayable
+			}
+		}
+	}
+	restore, err := r.keepBodyPosition()
+	if err != nil {
+		return nil, err
+	}
+	cp := *r
+	cp.Header = r.Header.Clone()
+	cp.Attempt = 0
+	body, err := handleRequestBody(r.boundClient(), &cp)
+	if err != nil {
+		restore()
+		return nil, err
+	}
+	rs, ok := body.(io.ReadSeeker)
+	if !ok {
+		if c, ok := body.(io.Closer); ok {
+			c.Close()
+		}
+		restore()
+		return nil, ErrBodyNotReplayable
+	}
+	b, err := io.ReadAll(rs)
+	if rerr := restore(); err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// boundClient returns the client the request is executed with, the default client for requests
+// created with [NewRequest].
+func (r *Request) boundClient() *Client {
+	if r.client != nil {
+		return r.client
+	}
+	return defaultClient()
+}
+
+// keepBodyPosition records the read position of a seekable body, or of the files of a multipart
+// form, and returns func restoring it, so the body can be encoded for a copy of the request without
+// being consumed.
+func (r *Request) keepBodyPosition() (func() error, error) {
+	if f, ok := r.Body.(*MultipartForm); ok {
+		return f.keepPosition()
+	}
+	s, ok := r.Body.(io.Seeker)
+	if !ok {
+		return func() error { return nil }, nil
+	}
+	return keepPosition(s)
+}
+
+// keepPosition records the read position of s and returns func restoring it.
+func keepPosition(s io.Seeker) (func() error, error) {
+	pos, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		_, err := s.Seek(pos, io.SeekStart)
+		return err
+	}, nil
+}
+
 func (r *Request) isIdempotent() bool {
 	if r.AllowNonIdempotentRetry {
 		return true
@@ -157,7 +569,7 @@ func (r *Request) isPayloadAllowed() bool {
 	case "", http.MethodGet:
 		return r.AllowGetPayload
 	case http.MethodDelete:
-		return r.AlloweDeletePayload
+		return r.AllowDeletePayload || r.AlloweDeletePayload
 	case http.MethodPost, http.MethodPut, http.MethodPatch:
 		return true
 	}
@@ -179,13 +591,31 @@ func (r *Request) isPayloadAllowed() bool {
 //
 //   - When using the default retry, place any post-processing logic
 //     (e.g. decoding JSON, logging, validation) in the Cond function itself.
-func (r *Request) Exec() (*Response, error) {
+func (r *Request) Exec() (res *Response, err error) {
 	var (
-		res *Response
-		err error
-		now = time.Now()
+		now       = time.Now()
+		reused    []bool
+		durations []time.Duration
 	)
 
+	if r.ctx == nil {
+		r.ctx = context.Background()
+	}
+
+	// Requests created with NewRequest are not bound to a client
+	r.client = r.boundClient()
+
+	if r.timeout > 0 {
+		release := r.withTimeout(r.timeout)
+		defer func() { release(res) }()
+	}
+	var deadline time.Time
+	if r.deadline > 0 {
+		deadline = now.Add(r.deadline)
+		release := r.withTimeout(r.deadline)
+		defer func() { release(res) }()
+	}
+
 	// If retry is nil set it because we need retry.Count
 	if r.retry == nil {
 		r.retry = &Retry{}
@@ -194,11 +624,35 @@ func (r *Request) Exec() (*Response, error) {
 	if r.retry.Count < 0 {
 		r.retry.Count = 0
 	}
+	retries := r.retry.retries()
 
 Loop:
-	for attempt := 0; attempt <= r.retry.Count; attempt++ {
+	for attempt := 0; attempt <= retries; attempt++ {
 		r.Attempt++
-		res, err = r.client.exec(r)
+		start := time.Now()
+		if r.isHedged() {
+			res, err = r.client.execHedged(r)
+		} else {
+			res, err = r.client.exec(r)
+		}
+		durations = append(durations, time.Since(start))
+		if r.tracer != nil {
+			reused = append(reused, r.tracer.IsConnReused)
+		}
+		// Server refused the Expect header, send the request once more without it. It's not
+		// counted as a retry.
+		if err == nil && res.StatusCode == http.StatusExpectationFailed &&
+			r.Header.Get("Expect") != "" && r.canReplay() {
+			res.Close()
+			if err = r.rewindBody(); err != nil {
+				break
+			}
+			r.Header.Del("Expect")
+			attempt--
+			r.Attempt--
+			continue
+		}
+
 		if err != nil {
 			ctxErr := r.Context().Err()
 			if ctxErr != nil && errors.Is(ctxErr, context.DeadlineExceeded) {
@@ -206,41 +660,137 @@ Loop:
 			}
 		}
 
-		if r.Attempt-1 == r.retry.Count && r.isIdempotent() {
+		if r.Attempt-1 == retries && r.isIdempotent() {
 			break
 		}
 
 		if r.IsRetry {
 			// Default condition will always be checked
-			needsRetry := defaultRetryCondition(res, err)
+			needsRetry := r.retry.defaultCondition(res, err)
+			redirectWait, redirectRetry := r.retry.redirectRetryAfter(res, r.client.redirectDisabled)
+			needsRetry = needsRetry || redirectRetry
 			// if default condition is false then execute the user one
 			if !needsRetry && r.retry.Cond != nil && res != nil {
 				needsRetry = r.retry.Cond(res, err)
 			}
+			for i := 0; !needsRetry && i < len(r.retryIf); i++ {
+				needsRetry = r.retryIf[i](res, err)
+			}
 
 			if !needsRetry {
 				break
 			}
 
-			if res != nil && res.Body != nil {
-				_, _ = io.Copy(io.Discard, res.Body)
-				res.Body.Close()
+			wait := r.retry.Wait
+			if r.retry.Backoff != nil {
+				wait = r.retry.Backoff.NextWaitDuration(res, attempt)
+			}
+			if redirectRetry {
+				wait = redirectWait
 			}
 
-			if r.retry.Backoff != nil {
-				r.retry.Wait = r.retry.Backoff.NextWaitDuration(res, attempt)
+			// Stop once the next attempt would start after the elapsed time limit or the deadline
+			if m := r.retry.MaxElapsedTime; m > 0 && time.Since(now)+wait > m {
+				break
+			}
+			if !deadline.IsZero() && time.Now().Add(wait).After(deadline) {
+				break
+			}
+
+			if b := r.client.retryBudget; b != nil && !b.Allow() {
+				if l := r.client.logger; l != nil {
+					l.Warn("httpx: retry budget exhausted", "url", r.URI, "attempt", r.Attempt)
+				}
+				break
 			}
 
-			timer := time.NewTimer(r.retry.Wait)
+			// Streams such as multipart streaming bodies or streaming body exceeding its buffer can
+			// not be replayed, the last response is returned instead of retrying
+			if !r.canReplay() {
+				if l := r.client.logger; l != nil {
+					l.Warn("httpx: request body can not be replayed", "url", r.URI)
+				}
+				break
+			}
+
+			// Response may arrive before the body is fully sent, it's closed first so transport
+			// stops writing the body before it's rewound.
+			if res != nil {
+				res.Close()
+			}
+			if rerr := r.rewindBody(); rerr != nil {
+				err = rerr
+				break
+			}
+
+			if l := r.client.logger; l != nil {
+				status := 0
+				if res != nil {
+					status = res.StatusCode
+				}
+				l.Debug("httpx: retrying request", "url", r.URI, "attempt", r.Attempt,
+					"status", status, "error", err, "wait", wait)
+			}
+
+			if r.retry.OnRetry != nil {
+				r.retry.OnRetry(res, err, attempt+1, wait)
+			}
+
+			timer := acquireTimer(wait)
 			select {
 			case <-r.Context().Done():
+				releaseTimer(timer)
 				err = r.Context().Err()
 				break Loop
 			case <-timer.C:
 			}
-			timer.Stop()
+			releaseTimer(timer)
 		}
 	}
 	r.TotalTime = time.Since(now)
+	if res != nil {
+		res.AttemptsReusedConn = reused
+		res.AttemptDurations = durations
+	}
+	if err == nil && res != nil && !res.Success() && (r.ErrorOnHTTPError || r.client.errorOnHTTPError) {
+		err = res.httpError()
+	}
+	if err != nil && r.client.errorHook != nil {
+		r.client.errorHook(r, err)
+	}
 	return res, err
 }
+
+// withTimeout bounds the request context by d, the returned func restores the previous context
+// and releases the timeout once the body of res is closed or right away without a response.
+func (r *Request) withTimeout(d time.Duration) func(res *Response) {
+	parent := r.ctx
+	ctx, cancel := context.WithTimeout(parent, d)
+	r.ctx = ctx
+	return func(res *Response) {
+		r.ctx = parent
+		// Response may come with an error e.g. HTTPError, its body is still readable
+		if res != nil && res.Body != nil {
+			res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+		} else {
+			cancel()
+		}
+	}
+}
+
+// ExecInto executes the request and decodes the body of successful response into T using the
+// content type decoder, the body is closed afterwards. Unsuccessful responses fail with the http
+// error when error on http error is enabled, otherwise they are returned undecoded with zero T and
+// the body is left for the caller to read and close.
+func ExecInto[T any](r *Request) (T, *Response, error) {
+	var v T
+	res, err := r.Exec()
+	if err != nil || !res.Success() {
+		return v, res, err
+	}
+	defer res.Body.Close()
+	if err := res.Decode(&v); err != nil {
+		return v, res, err
+	}
+	return v, res, nil
+}
@@ -0,0 +1,716 @@
+package httpxgo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSetTimeoutSlowServer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	_, err := New().Get(srv.URL).SetTimeout(50 * time.Millisecond).Exec()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+}
+
+func TestSetTimeoutHTTPErrorBodyReadable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "missing", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	res, err := New().Get(srv.URL).SetTimeout(time.Second).EnableErrorOnHTTPError().Exec()
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("err = %v, want HTTPError", err)
+	}
+	defer res.Body.Close()
+	body, err := res.String()
+	if err != nil {
+		t.Fatalf("reading body of http error: %v", err)
+	}
+	if body != "missing\n" {
+		t.Fatalf("body = %q", body)
+	}
+}
+
+func TestSetTimeoutCancelsOnce(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("httpx"))
+	}))
+	defer srv.Close()
+
+	res, err := New().Get(srv.URL).SetTimeout(time.Minute).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := res.Request.Context()
+	var cancels atomic.Int32
+	context.AfterFunc(ctx, func() { cancels.Add(1) })
+	if ctx.Err() != nil {
+		t.Fatal("context cancelled before the body is closed")
+	}
+	if body, _ := res.String(); body != "httpx" {
+		t.Fatalf("body = %q", body)
+	}
+	res.Body.Close()
+	res.Body.Close()
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Fatalf("context err = %v after closing the body, want canceled", ctx.Err())
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := cancels.Load(); n != 1 {
+		t.Fatalf("context cancelled %d times, want exactly once", n)
+	}
+}
+
+func TestSetDeadlineBoundsRetries(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	res, err := New().Get(srv.URL).
+		SetRetry(&Retry{Count: 100, Wait: 30 * time.Millisecond}).
+		SetDeadline(200 * time.Millisecond).
+		Exec()
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want the last 503", res.StatusCode)
+	}
+	if elapsed > 200*time.Millisecond+100*time.Millisecond {
+		t.Fatalf("Exec took %v, want it bounded by the deadline", elapsed)
+	}
+	if n := hits.Load(); n < 2 || n > 8 {
+		t.Fatalf("server hit %d times, want retries within the deadline only", n)
+	}
+}
+
+func TestSetDeadlineSlowServer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	_, err := New().Get(srv.URL).SetRetry(&Retry{Count: 3}).SetDeadline(50 * time.Millisecond).Exec()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+}
+
+func TestSetDeadlineWithContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// The earlier of the caller context and the deadline wins
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req := New().Get(srv.URL).WithContext(ctx).
+		SetRetry(&Retry{Count: 100, Wait: 20 * time.Millisecond}).
+		SetDeadline(time.Minute)
+	start := time.Now()
+	_, err := req.Exec()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the caller context deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Exec took %v, want it bounded by the caller context", elapsed)
+	}
+	if req.Context() != ctx {
+		t.Fatal("caller context was not restored after Exec")
+	}
+}
+
+func TestSetQueryArray(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer srv.Close()
+
+	for range 5 {
+		res, err := New().Get(srv.URL).
+			SetQueryArray("id", []string{"3", "1", "2"}).
+			SetQuery("a", "x").
+			SetQueryArray("id", []string{"4"}).
+			Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := res.String()
+		res.Body.Close()
+		if want := "a=x&id=3&id=1&id=2&id=4"; got != want {
+			t.Fatalf("query = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestFinalBody(t *testing.T) {
+	b, err := New().Post("http://example.test", map[string]int{"a": 1}).
+		SetHeader("Content-Type", "application/json").FinalBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"a":1}` {
+		t.Fatalf("body = %q", b)
+	}
+
+	b, err = New().Post("http://example.test", nil).SetBodyGzipJSON(map[string]int{"a": 1}).FinalBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := io.ReadAll(zr)
+	if string(plain) != "{\"a\":1}\n" {
+		t.Fatalf("decompressed body = %q", plain)
+	}
+}
+
+func TestSetBodyGzipJSON(t *testing.T) {
+	type payload struct {
+		Name string `json:"name"`
+		IDs  []int  `json:"ids"`
+	}
+	var got []payload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("server: headers = %v", r.Header)
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("server: %v", err)
+			return
+		}
+		var p payload
+		if err := json.NewDecoder(zr).Decode(&p); err != nil {
+			t.Errorf("server: %v", err)
+		}
+		got = append(got, p)
+		// First attempt fails so the compressed body is replayed
+		if len(got) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	want := payload{Name: "httpx", IDs: []int{1, 2, 3}}
+	res, err := New().Post(srv.URL, nil).SetBodyGzipJSON(want).
+		SetRetry(&Retry{Count: 1, Wait: time.Millisecond}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if len(got) != 2 || !reflect.DeepEqual(got[0], want) || !reflect.DeepEqual(got[1], want) {
+		t.Fatalf("server decoded %+v, want %+v on both attempts", got, want)
+	}
+}
+
+func TestSetBodyNDJSON(t *testing.T) {
+	type item struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	var got [][]item
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("server: Content-Type = %q", ct)
+		}
+		b, _ := io.ReadAll(r.Body)
+		var items []item
+		for line := range strings.Lines(string(b)) {
+			var it item
+			if err := json.Unmarshal([]byte(line), &it); err != nil {
+				t.Errorf("server: line %q: %v", line, err)
+			}
+			items = append(items, it)
+		}
+		got = append(got, items)
+		// First attempt fails so the encoded body is replayed
+		if len(got) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	want := []item{{1, "a"}, {2, "b"}, {3, "c"}}
+	res, err := New().Post(srv.URL, nil).SetBodyNDJSON([]any{want[0], want[1], want[2]}).
+		SetRetry(&Retry{Count: 1, Wait: time.Millisecond}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if len(got) != 2 || !slices.Equal(got[0], want) || !slices.Equal(got[1], want) {
+		t.Fatalf("server decoded %v, want %v on both attempts", got, want)
+	}
+}
+
+func TestFinalBodyKeepsReaderBody(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("server: %v", err)
+			return
+		}
+		b, _ := io.ReadAll(zr)
+		got = append(got, string(b))
+	}))
+	defer srv.Close()
+
+	// Not bound to a client, the default client is used as in Exec
+	req := NewRequest().SetMethod(http.MethodPost).SetURL(srv.URL).
+		SetBody(strings.NewReader("payload")).SetRequestCompression("gzip")
+	if _, err := req.FinalBody(); err != nil {
+		t.Fatal(err)
+	}
+	res, err := req.Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if len(got) != 1 || got[0] != "payload" {
+		t.Fatalf("server received %q, want payload", got)
+	}
+}
+
+func TestStreamingUploadCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	// The body never ends, only the cancellation stops the upload
+	_, err := New().Post(srv.URL, nil).SetBody(zeroReader{}).WithContext(ctx).Exec()
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context canceled", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("upload stopped after %v, want promptly after cancellation", d)
+	}
+}
+
+func TestExpectationFailedResendIsNotRetry(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if r.Header.Get("Expect") != "" {
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	res, err := New().Post(srv.URL, "hello").SetHeader("Expect", "100-continue").
+		SetRetry(&Retry{Count: 2, Wait: time.Millisecond}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("status = %d", res.StatusCode)
+	}
+	// 417, then the first attempt without Expect and 2 retries
+	if len(bodies) != 4 {
+		t.Fatalf("requests = %d, want 4", len(bodies))
+	}
+	for i, b := range bodies {
+		if b != "hello" {
+			t.Fatalf("request %d body = %q", i, b)
+		}
+	}
+}
+
+// generate returns a non seekable body of n bytes cycling through the alphabet.
+func generate(n int) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		for i := range n {
+			pw.Write([]byte{byte('a' + i%26)})
+		}
+		pw.Close()
+	}()
+	return pr
+}
+
+func TestStreamingBodyReplay(t *testing.T) {
+	var requests atomic.Int32
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, b)
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	// Small body fits into the buffer and is replayed
+	res, err := New().Post(srv.URL, nil).SetStreamingBody(generate(1000), 1024).
+		SetRetry(&Retry{Count: 1, Wait: time.Millisecond}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || len(bodies) != 2 {
+		t.Fatalf("status = %d after %d requests, want 200 after a retry", res.StatusCode, len(bodies))
+	}
+	if len(bodies[0]) != 1000 || !bytes.Equal(bodies[0], bodies[1]) {
+		t.Fatalf("replayed body of %d bytes does not match the first one of %d bytes",
+			len(bodies[1]), len(bodies[0]))
+	}
+
+	// Large body overflows the buffer, the first response is returned without retrying
+	requests.Store(0)
+	bodies = nil
+	res, err = New().Post(srv.URL, nil).SetStreamingBody(generate(4096), 1024).
+		SetRetry(&Retry{Count: 1, Wait: time.Millisecond}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable || len(bodies) != 1 || len(bodies[0]) != 4096 {
+		t.Fatalf("status = %d after %d requests, want the first 503 without retry",
+			res.StatusCode, len(bodies))
+	}
+}
+
+func TestStreamingBodyRetryEarlyResponse(t *testing.T) {
+	const size = 4 << 20
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// First attempt is answered before the upload finishes
+		if requests.Add(1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		n, _ := io.Copy(io.Discard, r.Body)
+		fmt.Fprint(w, n)
+	}))
+	defer srv.Close()
+
+	body := io.LimitReader(zeroReader{}, size)
+	res, err := New().Post(srv.URL, nil).SetStreamingBody(body, 2*size).
+		SetRetry(&Retry{Count: 1, Wait: time.Millisecond}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	got, _ := res.String()
+	if res.StatusCode != http.StatusOK || got != strconv.Itoa(size) {
+		t.Fatalf("status = %d, received %s bytes, want %d", res.StatusCode, got, size)
+	}
+}
+
+func TestExpectationFailedResendStreamingBody(t *testing.T) {
+	const size = 8 << 20
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Expect") != "" {
+			// Reading sends 100 Continue so the upload is in flight when 417 is returned
+			r.Body.Read(make([]byte, 1))
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+		n, _ := io.Copy(io.Discard, r.Body)
+		fmt.Fprint(w, n)
+	}))
+	defer srv.Close()
+
+	res, err := New().Post(srv.URL, nil).SetHeader("Expect", "100-continue").
+		SetStreamingBody(io.LimitReader(zeroReader{}, size), 2*size).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	got, _ := res.String()
+	if res.StatusCode != http.StatusOK || got != strconv.Itoa(size) {
+		t.Fatalf("status = %d, received %s bytes, want %d", res.StatusCode, got, size)
+	}
+}
+
+// echoServer answers with the request method and body.
+func echoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s", r.Method, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDeleteWithBody(t *testing.T) {
+	srv := echoServer(t)
+	res, err := New().DeleteWithBody(srv.URL, map[string][]int{"ids": {1, 2}}).
+		SetHeader("Content-Type", "application/json").
+		Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if got, _ := res.String(); got != `DELETE {"ids":[1,2]}` {
+		t.Fatalf("body = %q, want the encoded DELETE payload", got)
+	}
+}
+
+func TestAllowDeletePayloadFieldNames(t *testing.T) {
+	srv := echoServer(t)
+	for name, allow := range map[string]func(*Request){
+		"none":                func(*Request) {},
+		"AllowDeletePayload":  func(r *Request) { r.AllowDeletePayload = true },
+		"AlloweDeletePayload": func(r *Request) { r.AlloweDeletePayload = true },
+	} {
+		req := New().Delete(srv.URL).SetBody([]int{1}).SetHeader("Content-Type", "application/json")
+		allow(req)
+		res, err := req.Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := res.String()
+		res.Body.Close()
+		want := "DELETE [1]"
+		if name == "none" {
+			want = "DELETE "
+		}
+		if got != want {
+			t.Errorf("%s: body = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestBodyFactoryRetry(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if len(bodies) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	var calls int
+	res, err := New().Post(srv.URL, nil).
+		SetBody(strings.NewReader("ignored")).
+		SetBodyFactory(func() (io.Reader, error) {
+			calls++
+			return generate(2048), nil
+		}).
+		SetRetry(&Retry{Count: 2, Wait: time.Millisecond}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || len(bodies) != 3 || calls != 3 {
+		t.Fatalf("status = %d after %d requests and %d factory calls, want 200 after 3 of each",
+			res.StatusCode, len(bodies), calls)
+	}
+	for i, b := range bodies {
+		if len(b) != 2048 || b != bodies[0] {
+			t.Fatalf("attempt %d sent %d bytes, want the same 2048 byte body each time", i+1, len(b))
+		}
+	}
+
+	// Factory errors fail the request
+	_, err = New().Post(srv.URL, nil).SetBodyFactory(func() (io.Reader, error) {
+		return nil, io.ErrUnexpectedEOF
+	}).Exec()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("err = %v, want factory error", err)
+	}
+}
+
+func TestAuthorizationHeader(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		name string
+		req  *Request
+		want string
+	}{
+		{"basic", New().Get(srv.URL).SetBasicAuth("Aladdin", "open sesame"),
+			"Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ=="},
+		// Credentials are encoded as is, servers split the user id at the first colon
+		{"colon in password", New().Get(srv.URL).SetBasicAuth("user", "pa:ss"),
+			"Basic dXNlcjpwYTpzcw=="},
+		{"colon in user", New().Get(srv.URL).SetBasicAuth("us:er", "pw"), "Basic dXM6ZXI6cHc="},
+		{"bearer", New().Get(srv.URL).SetBearerToken("t0ken"), "Bearer t0ken"},
+		{"last wins", New().Get(srv.URL).SetBasicAuth("a", "b").SetBearerToken("t0ken"),
+			"Bearer t0ken"},
+	} {
+		res, err := tt.req.Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := res.String()
+		res.Body.Close()
+		if got != tt.want {
+			t.Errorf("%s: Authorization = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRequestCompressionRoundTrip(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			http.Error(w, "not compressed", http.StatusBadRequest)
+			return
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, err := io.ReadAll(zr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		// First attempt fails so the compressed body is replayed
+		if hits.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	body := map[string]string{"name": strings.Repeat("httpx", 1000)}
+	res, err := New().Post(srv.URL, body).SetHeader("Content-Type", "application/json").
+		SetRequestCompression("gzip").SetRetry(&Retry{Count: 1, Wait: time.Millisecond}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var got map[string]string
+	if err := res.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || hits.Load() != 2 || !reflect.DeepEqual(got, body) {
+		t.Fatalf("status = %d after %d requests, want the body echoed after a retry",
+			res.StatusCode, hits.Load())
+	}
+
+	if _, err := New().Post(srv.URL, "x").SetRequestCompression("lz4").Exec(); err == nil {
+		t.Fatal("want error for encoding without compressor")
+	}
+}
+
+func TestSetBodyJSONXML(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s", r.Header.Get("Content-Type"), b)
+	}))
+	defer srv.Close()
+
+	type item struct {
+		XMLName struct{} `json:"-" xml:"item"`
+		ID      int      `json:"id" xml:"id"`
+	}
+	for _, tt := range []struct {
+		req  *Request
+		want string
+	}{
+		{New().Post(srv.URL, nil).SetBodyJSON(item{ID: 1}), `application/json {"id":1}`},
+		{New().Put(srv.URL, nil).SetBodyXML(item{ID: 1}), "application/xml <item><id>1</id></item>"},
+	} {
+		res, err := tt.req.Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := res.String()
+		res.Body.Close()
+		if strings.TrimSpace(got) != tt.want {
+			t.Errorf("server got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestExecInto(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"not found"}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":7,"name":"httpx"}`)
+	}))
+	defer srv.Close()
+
+	type user struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	u, res, err := ExecInto[user](New().Get(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != (user{ID: 7, Name: "httpx"}) || res.StatusCode != http.StatusOK {
+		t.Fatalf("decoded %+v with status %d", u, res.StatusCode)
+	}
+
+	// 4xx is returned undecoded with the body left to the caller
+	u, res, err = ExecInto[user](New().Get(srv.URL + "/missing"))
+	if err != nil || res.StatusCode != http.StatusNotFound || u != (user{}) {
+		t.Fatalf("got %+v, %v, want undecoded 404", u, err)
+	}
+	body, _ := res.String()
+	res.Body.Close()
+	if body != `{"error":"not found"}` {
+		t.Fatalf("body = %q", body)
+	}
+
+	// 4xx fails with the http error when error on http error is enabled
+	_, res, err = ExecInto[user](New().EnableErrorOnHTTPError().Get(srv.URL + "/missing"))
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("err = %v, want HTTPError for 404", err)
+	}
+	if res != nil {
+		res.Body.Close()
+	}
+}
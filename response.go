@@ -2,39 +2,143 @@ package httpxgo
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"mime"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
 	ErrTraceNotEnabled = errors.New("trace is not enabled")
 	ErrBodyIsRead      = errors.New("body is already read")
+	ErrBodyReadLimit   = errors.New("body read limit reached")
+	ErrBodyNotCached   = errors.New("body is not read with Bytes")
+	ErrBodyTooLarge    = errors.New("body exceeds the size limit")
 )
 
-// Response contains embdedd [http.Response] object so all the method of [http.Response] are
+// Response contains embedded [http.Response] object so all the method of [http.Response] are
 // accessible. In any case Response object doesn't close the underlying body it's callers
-// responsibility to close the response body[This is done deliberately to avoid double closing and
-// keeping Go semantic]. In any case if body is already read and method requring it called will
-// throw error.
+// responsibility to close the response body, either directly or with [Response.Close]. This is
+// done deliberately to avoid double closing and keeping Go semantic. In any case if body is already
+// read and method requiring it called will throw error.
 type Response struct {
 	*http.Response
 	traceInfo           *TraceInfo
 	decompressors       *contentTypeDecompressor
+	reqDecompressors    map[string]DecompressFn
 	contentTypeDecoders *contentTypeDecoders
+	preserveEncHeaders  bool
+	decompressFallback  bool
+	defaultContentType  string
+	meta                map[string]any
+	cached              []byte
+	earlyHints          http.Header
+	successCond         func(*Response) bool
+	ctEncodings         map[string]string
+	wireContentLength   int64
+	rawBody             io.ReadCloser
 	// This set body to already read so can not be read further
 	IsRead   bool
 	IsReused bool
+	// AttemptsReusedConn reports for each attempt whether it reused a pooled connection. Populated
+	// only when trace is enabled.
+	AttemptsReusedConn []bool
+	// AttemptDurations is the duration of each attempt excluding the wait between retries.
+	AttemptDurations []time.Duration
 }
 
-// Success checks wether the response status code is in positive range.
+// Close discards a bounded remainder of the body and closes it, so the connection can be reused
+// even if the body is not read. It fulfils the caller closes contract of Response and can be used
+// in place of closing the body directly.
+func (r *Response) Close() error {
+	if r.Response == nil || r.Body == nil {
+		return nil
+	}
+	raw := r.rawBody
+	if raw == nil {
+		raw = r.Body
+	}
+	return drainBody(r.Body, raw)
+}
+
+// WireContentLength returns the Content-Length of the response as received, before it was
+// decompressed. It reports false when the length was not declared or was dropped by the transport
+// decompressing the body itself.
+func (r *Response) WireContentLength() (int64, bool) {
+	return r.wireContentLength, r.wireContentLength >= 0
+}
+
+// ContentLengthKnown reports whether the length of the body as read is known, it's not once the
+// body is decompressed.
+func (r *Response) ContentLengthKnown() bool {
+	return r.ContentLength >= 0
+}
+
+// Success checks wether the response status code is in positive range, or reports the result of
+// the condition set by [Request.SetSuccessCondition].
 func (r *Response) Success() bool {
+	if r.successCond != nil {
+		return r.successCond(r)
+	}
 	return r.StatusCode > 199 && r.StatusCode < 300
 }
 
+// StatusClass returns the class of the status code i.e. 1 for 1xx up to 5 for 5xx. It returns 0
+// when no status is available such as for a failed request.
+func (r *Response) StatusClass() int {
+	if r == nil || r.Response == nil || r.StatusCode < 100 || r.StatusCode > 599 {
+		return 0
+	}
+	return r.StatusCode / 100
+}
+
+// StatusText returns the text for the status code, see [http.StatusText].
+func (r *Response) StatusText() string {
+	if r == nil || r.Response == nil {
+		return ""
+	}
+	return http.StatusText(r.StatusCode)
+}
+
+// Meta returns the metadata set on the request with [Request.SetMeta].
+func (r *Response) Meta(k string) (any, bool) {
+	v, ok := r.meta[k]
+	return v, ok
+}
+
+// TLSState returns the state of the TLS connection the response was received on, nil for
+// unencrypted connections. It's the same as the TLS field of the embedded [http.Response].
+func (r *Response) TLSState() *tls.ConnectionState {
+	if r == nil || r.Response == nil {
+		return nil
+	}
+	return r.Response.TLS
+}
+
+// PeerCertificates returns the certificates presented by the server, leaf certificate first.
+func (r *Response) PeerCertificates() []*x509.Certificate {
+	if state := r.TLSState(); state != nil {
+		return state.PeerCertificates
+	}
+	return nil
+}
+
+// EarlyHints returns the headers of 103 Early Hints informational responses received before the
+// final response, nil if none were received.
+func (r *Response) EarlyHints() http.Header {
+	return r.earlyHints
+}
+
 func (r *Response) TraceInfo() (*TraceInfo, error) {
 	if r.traceInfo == nil {
 		return nil, ErrTraceNotEnabled
@@ -43,12 +147,28 @@ func (r *Response) TraceInfo() (*TraceInfo, error) {
 }
 
 // Decode will decode given value based on [DecodeOptions] if none provided default will be
-// [JSONDecoder]. Make sure body should be pointer to variable you're trying to decode.
+// [JSONDecoder]. Make sure body should be pointer to variable you're trying to decode. If v is an
+// [io.Writer] the body is streamed into it as is regardless of content type. Responses without
+// Content-Type are decoded as [Client.SetDefaultDecodeContentType].
 func (r *Response) Decode(v any) error {
 	if r.IsRead && !r.IsReused {
 		return ErrBodyIsRead
 	}
-	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if w, ok := v.(io.Writer); ok {
+		r.IsRead = true
+		if _, err := io.Copy(w, r.Body); err != nil {
+			return fmt.Errorf("error writing the body, err: %w", err)
+		}
+		return nil
+	}
+	ct := r.Header.Get("Content-Type")
+	if strings.TrimSpace(ct) == "" {
+		ct = r.defaultContentType
+		if ct == "" {
+			ct = contentTypeJSON
+		}
+	}
+	mt, _, err := mime.ParseMediaType(ct)
 	if err != nil {
 		return err
 	}
@@ -60,6 +180,67 @@ func (r *Response) Decode(v any) error {
 	return dec(v, r.Body)
 }
 
+// DecodeMap decodes the body into a generic map using the content type decoder. It returns error if
+// the body is not an object.
+func (r *Response) DecodeMap() (map[string]any, error) {
+	var m map[string]any
+	if err := r.Decode(&m); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, errors.New("response body is not an object")
+	}
+	return m, nil
+}
+
+// DecodeEnvelope decodes only the top level field of a JSON object body into v, e.g. "data" of
+// {"data": {...}, "meta": {...}}. Other fields are skipped while streaming without being decoded.
+func (r *Response) DecodeEnvelope(field string, v any) error {
+	if r.IsRead && !r.IsReused {
+		return ErrBodyIsRead
+	}
+	r.IsRead = true
+	dec := json.NewDecoder(r.Body)
+	if t, err := dec.Token(); err != nil {
+		return err
+	} else if t != json.Delim('{') {
+		return errors.New("response body is not an object")
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key, _ := t.(string); key == field {
+			return dec.Decode(v)
+		}
+		if err := skipJSONValue(dec); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("field %s not found in response body", field)
+}
+
+// skipJSONValue skips the next value of dec without decoding it.
+func skipJSONValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
 func (r *Response) Bytes() ([]byte, error) {
 	if r.IsRead && !r.IsReused {
 		return nil, ErrBodyIsRead
@@ -69,9 +250,58 @@ func (r *Response) Bytes() ([]byte, error) {
 		return nil, fmt.Errorf("error reading the body, err: %w", err)
 	}
 	r.IsRead = true
+	r.cached = b
 	return b, nil
 }
 
+// String reads the whole body as a string, see [Response.Bytes].
+func (r *Response) String() (string, error) {
+	b, err := r.Bytes()
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// SaveToFile streams the body into the file at path without buffering it in memory, parent
+// directories are created if missing. It returns the number of bytes written.
+func (r *Response) SaveToFile(path string) (int64, error) {
+	if r.IsRead && !r.IsReused {
+		return 0, ErrBodyIsRead
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r.Body)
+	r.IsRead = true
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return n, fmt.Errorf("error saving the body, err: %w", err)
+	}
+	return n, nil
+}
+
+// Cached makes the body read by [Response.Bytes] readable again from memory, so Decode or Bytes can
+// be called on the same response afterwards. It returns [ErrBodyNotCached] if the body was not read
+// with Bytes. The buffer is shared with the slice returned by Bytes and must not be modified.
+func (r *Response) Cached() error {
+	if r.cached == nil {
+		return ErrBodyNotCached
+	}
+	if !r.IsReused {
+		r.Body.Close()
+	}
+	r.Body = &nopReadCloser{br: bytes.NewReader(r.cached)}
+	r.IsReused = true
+	return nil
+}
+
 // wrapDecompressor decompresses well known format such as gzip, x-gzip, deflate. Other widely used
 // format such as brotli, zstd or custom you can set decompressor using client.
 func (r *Response) wrapDecompressor() error {
@@ -80,56 +310,275 @@ func (r *Response) wrapDecompressor() error {
 	}
 
 	v := strings.TrimSpace(r.Header.Get("Content-Encoding"))
+	if v == "" && len(r.ctEncodings) > 0 && !r.Uncompressed {
+		mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		v = r.ctEncodings[mt]
+	}
 	if v == "" || v == "identity" {
 		return nil
 	}
 
-	fn, ok := r.decompressors.get(v)
-	if !ok {
-		return fmt.Errorf("decompressor not found for %s", v)
+	// Decompressor registered for the exact header value takes precedence, otherwise multiple
+	// encodings are chained in reverse order of application.
+	var fns []DecompressFn
+	if fn, ok := r.decompressor(v); ok {
+		fns = append(fns, fn)
+	} else {
+		tokens := strings.Split(v, ",")
+		for i := len(tokens) - 1; i >= 0; i-- {
+			token := strings.TrimSpace(tokens[i])
+			if token == "" || token == "identity" {
+				continue
+			}
+			fn, ok := r.decompressor(token)
+			if !ok {
+				return fmt.Errorf("decompressor not found for %s", token)
+			}
+			fns = append(fns, fn)
+		}
+	}
+	body := r.Body
+	var rec *recordingReader
+	if r.decompressFallback {
+		rec = &recordingReader{ReadCloser: r.Body, recording: true}
+		body = rec
+	}
+	dec := body
+	var err error
+	for _, fn := range fns {
+		if dec, err = fn(dec); err != nil {
+			break
+		}
+	}
+	if rec != nil {
+		rec.stop()
 	}
-	dec, err := fn(r.Body)
 	if err != nil {
 		if errors.Is(err, io.EOF) {
 			return nil
 		}
+		if rec != nil {
+			// Serve the raw body so caller can still read e.g. the error page
+			r.Body = rec.raw()
+			return nil
+		}
 		return err
 	}
 	r.Body = dec
-	r.Header.Del("Content-Encoding")
-	r.Header.Del("Content-Length")
 	r.ContentLength = -1
+	if !r.preserveEncHeaders {
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+	}
 	return nil
 }
 
+// decompressor returns the decompressor of the request or the client registered for key.
+func (r *Response) decompressor(key string) (DecompressFn, bool) {
+	if fn, ok := r.reqDecompressors[key]; ok {
+		return fn, true
+	}
+	return r.decompressors.get(key)
+}
+
 // EnableMultiBodyReads buffers the response body in memory and makes it reusable across
-// multiple reads. Must call before Decode or Bytes to enabled resuse of response body.
+// multiple reads. Must call before Decode or Bytes to enabled resuse of response body. The original
+// body is closed once buffered so the connection is returned to the pool, closing the buffered
+// body is a no-op.
 func (r *Response) EnableMultiBodyReads() error {
-	b, err := r.Bytes()
+	return r.multiBodyReads(0)
+}
+
+// MultiReadBodyN is like [Response.EnableMultiBodyReads] but the body can be read to the end at
+// most n times, further reads return [ErrBodyReadLimit] instead of starting over. It guards
+// against consumers looping over the body forever.
+func (r *Response) MultiReadBodyN(n int) error {
+	return r.multiBodyReads(n)
+}
+
+// EnablePooledMultiBodyReads is like [Response.EnableMultiBodyReads] but the buffer is taken from a
+// pool shared across responses, reducing allocations in high throughput pipelines. Closing the body
+// returns the buffer to the pool so the body must be closed and not read afterwards.
+func (r *Response) EnablePooledMultiBodyReads() error {
+	if r.IsRead && !r.IsReused {
+		return ErrBodyIsRead
+	}
+	buf := bodyBufferPool.Get().(*bytes.Buffer)
+	_, err := buf.ReadFrom(r.Body)
+	r.Body.Close()
 	if err != nil {
-		return err
+		putBodyBuffer(buf)
+		return fmt.Errorf("error reading the body, err: %w", err)
 	}
+	r.Body = &nopReadCloser{br: bytes.NewReader(buf.Bytes()), pooled: buf}
+	r.IsReused = true
+	return nil
+}
+
+func (r *Response) multiBodyReads(limit int) error {
+	if r.IsRead && !r.IsReused {
+		return ErrBodyIsRead
+	}
+	b, err := io.ReadAll(r.Body)
+	// Original body is consumed, closing it releases the connection back to the pool.
 	r.Body.Close()
-	r.Body = &nopReadCloser{bytes.NewReader(b)}
+	if err != nil {
+		return fmt.Errorf("error reading the body, err: %w", err)
+	}
+	r.Body = &nopReadCloser{br: bytes.NewReader(b), limit: limit}
 	r.IsReused = true
 	return nil
 }
 
+// maxPooledBodyBuffer is the capacity above which buffers are not returned to the pool so a single
+// huge body doesn't stay in memory.
+const maxPooledBodyBuffer = 4 << 20
+
+var bodyBufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+func putBodyBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBodyBuffer {
+		return
+	}
+	buf.Reset()
+	bodyBufferPool.Put(buf)
+}
+
+// recordingReader records bytes read while the decompressor initializes so the raw body can be
+// restored if it fails.
+type recordingReader struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	recording bool
+}
+
+func (rr *recordingReader) Read(p []byte) (int, error) {
+	n, err := rr.ReadCloser.Read(p)
+	if rr.recording {
+		rr.buf.Write(p[:n])
+	}
+	return n, err
+}
+
+func (rr *recordingReader) stop() {
+	rr.recording = false
+}
+
+// raw returns the body as it was sent by server including the recorded bytes.
+func (rr *recordingReader) raw() io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(&rr.buf, rr.ReadCloser), rr.ReadCloser}
+}
+
+const (
+	drainLimit   = 256 << 10
+	drainTimeout = time.Second
+)
+
+// drainBody discards up to drainLimit bytes of the body so the connection can be reused and closes
+// it. A body which does not finish within drainTimeout is aborted by closing raw, the transport
+// body underneath the decoders, which is safe during a read. The body itself is closed only once
+// the drain stopped reading, decoders are not safe to close concurrently with a read.
+func drainBody(body, raw io.ReadCloser) error {
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.CopyN(io.Discard, body, drainLimit)
+		close(done)
+	}()
+	timer := acquireTimer(drainTimeout)
+	select {
+	case <-done:
+	case <-timer.C:
+		raw.Close()
+		<-done
+	}
+	releaseTimer(timer)
+	return body.Close()
+}
+
+// limitedBody fails reads with [ErrBodyTooLarge] once the body turns out to be larger than the
+// limit, instead of silently truncating it.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Limit is reached, body is too large only if there is more to read
+		var probe [1]byte
+		n, err := b.ReadCloser.Read(probe[:])
+		if n > 0 {
+			return 0, ErrBodyTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// contextBody aborts body reads promptly once the request context is cancelled instead of
+// waiting on a possibly dead connection.
+type contextBody struct {
+	io.ReadCloser
+	ctx context.Context
+}
+
+func (b *contextBody) Read(p []byte) (int, error) {
+	if err := b.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return b.ReadCloser.Read(p)
+}
+
 // nopReadCloser automatically reset the read buffer after
 // reading is complete, Essentially making it infinite reader.
+// If limit is set reader stops after limit complete reads.
 type nopReadCloser struct {
-	br *bytes.Reader
+	br     *bytes.Reader
+	limit  int
+	passes int
+	pooled *bytes.Buffer
 }
 
 // Read implments [io.Reader] interface.
 func (r *nopReadCloser) Read(p []byte) (int, error) {
+	if r.br == nil {
+		return 0, http.ErrBodyReadAfterClose
+	}
+	if r.limit > 0 && r.passes >= r.limit {
+		return 0, ErrBodyReadLimit
+	}
 	n, err := r.br.Read(p)
 	if err == io.EOF {
+		r.passes++
 		r.br.Seek(0, io.SeekStart)
 	}
 	return n, err
 }
 
+// rewind starts the next read from the beginning, for consumers such as JSON decoders which stop
+// before reaching EOF.
+func (r *nopReadCloser) rewind() {
+	if r.br != nil {
+		r.br.Seek(0, io.SeekStart)
+	}
+}
+
+// Close returns the pooled buffer if any, otherwise it's no-op.
 func (r *nopReadCloser) Close() error {
+	if r.pooled != nil {
+		r.br = nil
+		putBodyBuffer(r.pooled)
+		r.pooled = nil
+	}
 	return nil
 }
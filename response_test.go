@@ -0,0 +1,637 @@
+package httpxgo
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowDeflateServer sends the start of a deflate body and stalls until the test ends.
+func slowDeflateServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	fw.Write(bytes.Repeat([]byte("httpx"), 1024))
+	fw.Flush()
+	stop := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "deflate")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(buf.Bytes())
+		w.(http.Flusher).Flush()
+		select {
+		case <-stop:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(func() {
+		close(stop)
+		srv.Close()
+	})
+	return srv
+}
+
+func TestResponseCloseSlowBody(t *testing.T) {
+	srv := slowDeflateServer(t)
+	res, err := New().Get(srv.URL).SetHeader("Accept-Encoding", "deflate").Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	res.Close()
+	if d := time.Since(start); d > drainTimeout+time.Second {
+		t.Fatalf("Close took %v, want about %v", d, drainTimeout)
+	}
+}
+
+func TestRetryDrainSlowBody(t *testing.T) {
+	srv := slowDeflateServer(t)
+	req := New().Get(srv.URL).SetHeader("Accept-Encoding", "deflate").
+		SetRetry(&Retry{Count: 1, Wait: time.Millisecond})
+	start := time.Now()
+	res, err := req.Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if req.Attempt != 2 {
+		t.Fatalf("attempts = %d, want 2", req.Attempt)
+	}
+	if d := time.Since(start); d > drainTimeout+time.Second {
+		t.Fatalf("Exec took %v, want drain to give up after %v", d, drainTimeout)
+	}
+}
+
+func newBodyResponse(body []byte) *Response {
+	return &Response{Response: &http.Response{Body: io.NopCloser(bytes.NewReader(body))}}
+}
+
+func TestPooledMultiBodyReads(t *testing.T) {
+	for i := range 50 {
+		want := bytes.Repeat([]byte{byte('a' + i%26)}, 1024+i)
+		res := newBodyResponse(want)
+		if err := res.EnablePooledMultiBodyReads(); err != nil {
+			t.Fatal(err)
+		}
+		for range 2 {
+			got, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("response %d: body does not match after pooled reuse", i)
+			}
+		}
+		res.Body.Close()
+		if _, err := res.Body.Read(make([]byte, 1)); err != http.ErrBodyReadAfterClose {
+			t.Fatalf("read after close: err = %v", err)
+		}
+	}
+}
+
+func TestMultiBodyReadsReleasesConnection(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("httpx"), 1024))
+	}))
+	defer srv.Close()
+
+	c := New()
+	res, err := c.Get(srv.URL).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := res.EnableMultiBodyReads(); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if b, _ := io.ReadAll(res.Body); len(b) != 5*1024 {
+			t.Fatalf("read %d bytes, want the whole body on every read", len(b))
+		}
+	}
+
+	// The buffered body is left unclosed, the connection must be back in the pool regardless
+	var reused bool
+	ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) { reused = info.Reused },
+	})
+	res, err = c.Get(srv.URL).WithContext(ctx).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Close()
+	if !reused {
+		t.Fatal("connection was not reused after EnableMultiBodyReads")
+	}
+}
+
+func TestMultiReadBodyN(t *testing.T) {
+	res := newBodyResponse([]byte("httpx"))
+	if err := res.MultiReadBodyN(2); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 2 {
+		got, err := io.ReadAll(res.Body)
+		if err != nil || string(got) != "httpx" {
+			t.Fatalf("pass %d: read %q, %v", i+1, got, err)
+		}
+	}
+	if _, err := res.Body.Read(make([]byte, 8)); !errors.Is(err, ErrBodyReadLimit) {
+		t.Fatalf("third pass: err = %v, want ErrBodyReadLimit", err)
+	}
+
+	// Without a limit the body starts over indefinitely
+	res = newBodyResponse([]byte("httpx"))
+	res.EnableMultiBodyReads()
+	for range 10 {
+		if got, _ := io.ReadAll(res.Body); string(got) != "httpx" {
+			t.Fatalf("read %q, want the whole body on every pass", got)
+		}
+	}
+}
+
+func BenchmarkMultiBodyReads(b *testing.B) {
+	body := bytes.Repeat([]byte("httpx"), 16<<10)
+	b.Run("alloc", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			res := newBodyResponse(body)
+			res.EnableMultiBodyReads()
+			res.Body.Close()
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			res := newBodyResponse(body)
+			res.EnablePooledMultiBodyReads()
+			res.Body.Close()
+		}
+	})
+}
+
+func TestContentTypeDecoderMatcher(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("ct"))
+		w.Write([]byte("body of " + r.URL.Query().Get("ct")))
+	}))
+	defer srv.Close()
+
+	decodeText := func(v any, r io.Reader) error {
+		b, err := io.ReadAll(r)
+		*v.(*string) = "text:" + string(b)
+		return err
+	}
+	c := New().
+		SetContentTypeDecoderMatcher(func(mt string) (ContentTypeDecFn, bool) {
+			if strings.HasPrefix(mt, "text/") {
+				return decodeText, true
+			}
+			return nil, false
+		}).
+		SetContentTypeDecoder("text/csv", func(v any, r io.Reader) error {
+			*v.(*string) = "exact csv"
+			return nil
+		})
+
+	for ct, want := range map[string]string{
+		"text/plain":               "text:body of text/plain",
+		"text/html; charset=utf-8": "text:body of text/html; charset=utf-8",
+		"text/markdown":            "text:body of text/markdown",
+		"text/csv; header=present": "exact csv",
+		"application/octet-stream": "",
+	} {
+		res, err := c.Get(srv.URL).SetQuery("ct", ct).Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		err = res.Decode(&got)
+		res.Body.Close()
+		if want == "" {
+			if err == nil {
+				t.Errorf("%s: want no decoder found", ct)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("%s: decoded %q, %v, want %q", ct, got, err, want)
+		}
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	for code, want := range map[int]int{
+		0: 0, 99: 0, 100: 1, 101: 1, 200: 2, 204: 2, 301: 3, 304: 3,
+		404: 4, 429: 4, 500: 5, 503: 5, 599: 5, 600: 0,
+	} {
+		res := &Response{Response: &http.Response{StatusCode: code}}
+		if got := res.StatusClass(); got != want {
+			t.Errorf("StatusClass(%d) = %d, want %d", code, got, want)
+		}
+	}
+	if res := (&Response{Response: &http.Response{StatusCode: 404}}); res.StatusText() != "Not Found" {
+		t.Errorf("StatusText = %q, want Not Found", res.StatusText())
+	}
+	var res *Response
+	if res.StatusClass() != 0 || res.StatusText() != "" || (&Response{}).StatusClass() != 0 {
+		t.Error("want zero values for a failed request without response")
+	}
+}
+
+func TestBodyReadCancelled(t *testing.T) {
+	stop := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-stop:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	res, err := New().Get(srv.URL).WithContext(ctx).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	p := make([]byte, len("partial"))
+	if _, err := io.ReadFull(res.Body, p); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancel while the next read is blocked on the stalled connection
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = res.Body.Read(p)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context canceled", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("read returned after %v, want promptly after cancellation", d)
+	}
+	// Further reads fail right away
+	if _, err := res.Body.Read(p); !errors.Is(err, context.Canceled) {
+		t.Fatalf("read after cancellation: err = %v", err)
+	}
+}
+
+func TestDecodeMap(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(r.URL.Query().Get("body")))
+	}))
+	defer srv.Close()
+	get := func(body string) *Response {
+		res, err := New().Get(srv.URL).SetQuery("body", body).Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+
+	res := get(`{"id":1,"tags":["a"]}`)
+	m, err := res.DecodeMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["id"] != float64(1) || len(m["tags"].([]any)) != 1 {
+		t.Fatalf("decoded %v", m)
+	}
+	if _, err := res.DecodeMap(); !errors.Is(err, ErrBodyIsRead) {
+		t.Fatalf("second decode: err = %v, want ErrBodyIsRead", err)
+	}
+
+	for _, body := range []string{`[1,2]`, ``, `null`} {
+		if m, err := get(body).DecodeMap(); err == nil {
+			t.Errorf("body %q: decoded %v, want error", body, m)
+		}
+	}
+}
+
+func TestDecodeIntoWriter(t *testing.T) {
+	want := bytes.Repeat([]byte{0, 1, 2, 0xff}, 4096)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Content type without a decoder is streamed as is
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(want)
+	}))
+	defer srv.Close()
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "body.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	for _, w := range []io.Writer{&buf, f} {
+		res, err := New().Get(srv.URL).Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = res.Decode(w)
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("decode into %T: %v", w, err)
+		}
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatal("buffer does not match the body")
+	}
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("file does not match the body")
+	}
+}
+
+func TestCachedAfterBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":7}`))
+	}))
+	defer srv.Close()
+
+	res, err := New().Get(srv.URL).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if err := res.Cached(); !errors.Is(err, ErrBodyNotCached) {
+		t.Fatalf("Cached before Bytes: err = %v, want ErrBodyNotCached", err)
+	}
+	b, err := res.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct{ ID int }
+	if err := res.Decode(&v); !errors.Is(err, ErrBodyIsRead) {
+		t.Fatalf("Decode without Cached: err = %v, want ErrBodyIsRead", err)
+	}
+	if err := res.Cached(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := res.String(); err != nil || s != string(b) {
+		t.Fatalf("String after Cached = %q, %v, want %q", s, err, b)
+	}
+	if err := res.Decode(&v); err != nil || v.ID != 7 {
+		t.Fatalf("Decode after Cached: %+v, %v", v, err)
+	}
+}
+
+func TestDecodeEnvelope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Query().Get("body")))
+	}))
+	defer srv.Close()
+	get := func(body string) *Response {
+		res, err := New().Get(srv.URL).SetQuery("body", body).Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+
+	type user struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	// meta comes first and holds nested values which are skipped
+	res := get(`{"meta":{"page":{"next":[1,{"a":null}]},"total":2},"data":{"id":1,"name":"a"},"x":1}`)
+	var u user
+	if err := res.DecodeEnvelope("data", &u); err != nil {
+		t.Fatal(err)
+	}
+	if u != (user{ID: 1, Name: "a"}) {
+		t.Fatalf("decoded %+v", u)
+	}
+	if err := res.DecodeEnvelope("data", &u); !errors.Is(err, ErrBodyIsRead) {
+		t.Fatalf("second decode: err = %v, want ErrBodyIsRead", err)
+	}
+
+	if err := get(`{"meta":{}}`).DecodeEnvelope("data", &u); err == nil {
+		t.Error("missing field: want error")
+	}
+	if err := get(`[{"data":1}]`).DecodeEnvelope("data", &u); err == nil {
+		t.Error("array body: want error")
+	}
+}
+
+func TestEarlyHints(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Link", "</style.css>; rel=preload; as=style")
+		w.Header().Add("Link", "</app.js>; rel=preload; as=script")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Del("Link")
+		w.Write([]byte("page"))
+	}))
+	defer srv.Close()
+
+	res, err := New().Get(srv.URL).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want the final 200", res.StatusCode)
+	}
+	want := []string{"</style.css>; rel=preload; as=style", "</app.js>; rel=preload; as=script"}
+	if got := res.EarlyHints().Values("Link"); !slices.Equal(got, want) {
+		t.Fatalf("early hints Link = %q, want %q", got, want)
+	}
+	if res.Header.Get("Link") != "" {
+		t.Fatal("early hints leaked into the final response headers")
+	}
+}
+
+func TestDecodeWithoutContentType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Nil value stops the server from sniffing the content type
+		w.Header()["Content-Type"] = nil
+		w.Write([]byte(r.URL.Query().Get("body")))
+	}))
+	defer srv.Close()
+
+	type item struct {
+		ID int `json:"id" xml:"id"`
+	}
+	for _, tt := range []struct {
+		name, contentType, body string
+	}{
+		{"default json", "", `{"id":7}`},
+		{"configured xml", "application/xml", `<item><id>7</id></item>`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			if tt.contentType != "" {
+				c.SetDefaultDecodeContentType(tt.contentType)
+			}
+			res, err := c.Get(srv.URL).SetQuery("body", tt.body).Exec()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			if ct := res.Header.Get("Content-Type"); ct != "" {
+				t.Fatalf("response has Content-Type %q", ct)
+			}
+			var v item
+			if err := res.Decode(&v); err != nil {
+				t.Fatal(err)
+			}
+			if v.ID != 7 {
+				t.Fatalf("decoded %+v", v)
+			}
+		})
+	}
+}
+
+func TestSuccessCondition(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/done")
+		w.WriteHeader(http.StatusFound)
+	}))
+	defer srv.Close()
+
+	c := New().DisableRedirect().EnableErrorOnHTTPError()
+	res, err := c.Get(srv.URL).Exec()
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusFound {
+		t.Fatalf("err = %v, want HTTPError for 302 by default", err)
+	}
+	if res != nil {
+		res.Body.Close()
+	}
+
+	redirectOK := func(res *Response) bool { return res.StatusCode == http.StatusFound }
+	res, err = c.Get(srv.URL).SetSuccessCondition(redirectOK).Exec()
+	if err != nil {
+		t.Fatalf("err = %v, want 302 accepted by the condition", err)
+	}
+	defer res.Body.Close()
+	if !res.Success() {
+		t.Fatal("Success() = false, want the custom condition to be used")
+	}
+}
+
+func TestResponseString(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(gzipBytes(t, []byte("hello httpx")))
+	}))
+	defer srv.Close()
+
+	res, err := New().Get(srv.URL).SetHeader("Accept-Encoding", "gzip").Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	got, err := res.String()
+	if err != nil || got != "hello httpx" {
+		t.Fatalf("String() = %q, %v, want the decompressed body", got, err)
+	}
+	if !res.IsRead {
+		t.Fatal("IsRead = false after String")
+	}
+	if got, err := res.String(); !errors.Is(err, ErrBodyIsRead) || got != "" {
+		t.Fatalf("second String() = %q, %v, want ErrBodyIsRead", got, err)
+	}
+}
+
+func TestSaveToFile(t *testing.T) {
+	body := make([]byte, 4<<20)
+	for i := range body {
+		body[i] = byte(i * 7 % 251)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	res, err := New().Get(srv.URL).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	path := filepath.Join(t.TempDir(), "nested", "dir", "download.bin")
+	n, err := res.SaveToFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(body)) || !res.IsRead {
+		t.Fatalf("wrote %d bytes, IsRead = %v, want %d bytes read", n, res.IsRead, len(body))
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sha256.Sum256(saved) != sha256.Sum256(body) {
+		t.Fatal("saved file checksum does not match the body")
+	}
+	if _, err := res.SaveToFile(path); !errors.Is(err, ErrBodyIsRead) {
+		t.Fatalf("second save: err = %v, want ErrBodyIsRead", err)
+	}
+}
+
+func TestWireContentLength(t *testing.T) {
+	plain := []byte("httpx-go response body")
+	compressed := gzipBytes(t, plain)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(compressed)
+		case "/chunked":
+			w.(http.Flusher).Flush()
+			w.Write(plain)
+		default:
+			w.Write(plain)
+		}
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		path      string
+		wire      int64
+		wireKnown bool
+		known     bool
+	}{
+		{"/gzip", int64(len(compressed)), true, false},
+		{"/plain", int64(len(plain)), true, true},
+		{"/chunked", -1, false, false},
+	} {
+		res, err := New().Get(srv.URL+tt.path).SetHeader("Accept-Encoding", "gzip").Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wire, ok := res.WireContentLength()
+		known := res.ContentLengthKnown()
+		got, _ := res.Bytes()
+		res.Body.Close()
+		if wire != tt.wire || ok != tt.wireKnown || known != tt.known {
+			t.Errorf("%s: WireContentLength() = %d, %v ContentLengthKnown() = %v, want %d, %v %v",
+				tt.path, wire, ok, known, tt.wire, tt.wireKnown, tt.known)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("%s: body = %q", tt.path, got)
+		}
+	}
+}
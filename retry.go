@@ -2,27 +2,51 @@ package httpxgo
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"math"
 	"math/rand/v2"
 	"net/http"
 	"net/url"
+	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type Retry struct {
 	// static wait time between retry. If Backoff is set then wait won't be used
 	Wait time.Duration
-	// maxmium polling attempts to be performed before failing
+	// Count is the number of retries performed after the first attempt before failing, i.e. up to
+	// Count+1 requests are sent. Zero sends the request once.
 	Count int
+	// CountIsRetries states explicitly that Count is the number of retries after the first attempt
+	// rather than the total number of attempts. It's the default interpretation, setting it doesn't
+	// change the number of requests sent.
+	CountIsRetries bool
+	// MaxElapsedTime caps the total time spent in [Request.Exec], retries stop once the next attempt
+	// would start after it. Whichever of Count and MaxElapsedTime is hit first stops retries, zero
+	// means no limit.
+	MaxElapsedTime time.Duration
 	// Cond is condition in retry, all the post processing logic should go here such response
 	// parsing and status code checks. If Cond return true then request retried if false then retry
 	// stops.
 	Cond func(*Response, error) bool
+	// OnRetry is called before waiting for each retry with the last response or error, the number
+	// of the retry starting from 1 and the wait before it. Body of the response is already closed.
+	OnRetry func(res *Response, err error, attempt int, wait time.Duration)
 	// Backoff will use exponential backoff with jitter if nil static wait will be used
 	Backoff *BackoffWithJitter
+	// RetryOnZeroStatus retries responses without status code. A zero status usually means no
+	// response was produced, transport errors are retried based on the error itself regardless of
+	// this option.
+	RetryOnZeroStatus bool
+	// RetryOnRedirectRetryAfter treats a 3xx response carrying Retry-After as "retry later" instead
+	// of a redirect, waiting for the Retry-After duration. It only applies to clients with redirects
+	// disabled by [Client.DisableRedirect], redirects are followed as usual otherwise.
+	RetryOnRedirectRetryAfter bool
 }
 
 func NewRetry() *Retry {
@@ -32,6 +56,132 @@ func NewRetry() *Retry {
 	}
 }
 
+// WithJitter sets exponential backoff with jitter between minWait and maxWait, it's shortcut for
+// assigning [NewBackoffWithJitter] to Backoff.
+func (r *Retry) WithJitter(minWait, maxWait time.Duration, strategy JitterStrategy) *Retry {
+	r.Backoff = NewBackoffWithJitter(minWait, maxWait, strategy)
+	return r
+}
+
+// retries returns the number of retries after the first attempt.
+func (r *Retry) retries() int {
+	return r.Count
+}
+
+// RetryPredicate reports whether the request should be retried, it's called with nil response when
+// the request failed. See [Request.SetRetryIf].
+type RetryPredicate func(*Response, error) bool
+
+// RetryOnStatus retries responses with any of the status codes.
+func RetryOnStatus(codes ...int) RetryPredicate {
+	return func(res *Response, _ error) bool {
+		return res != nil && res.Response != nil && slices.Contains(codes, res.StatusCode)
+	}
+}
+
+// RetryOnError retries failed requests whose error satisfies matcher, e.g.
+// RetryOnError(func(err error) bool { return errors.Is(err, io.ErrUnexpectedEOF) }).
+func RetryOnError(matcher func(error) bool) RetryPredicate {
+	return func(_ *Response, err error) bool {
+		return err != nil && matcher(err)
+	}
+}
+
+// RetryOnJSONField retries responses whose JSON object body has value at the dot separated path,
+// e.g. RetryOnJSONField("status.state", "pending"). The body is made readable multiple times with
+// [Response.EnableMultiBodyReads] so it's not consumed for the final response.
+func RetryOnJSONField(path string, value any) RetryPredicate {
+	// Normalize the value the way it's decoded, e.g. int to float64
+	var want any
+	if b, err := json.Marshal(value); err == nil {
+		_ = json.Unmarshal(b, &want)
+	}
+	keys := strings.Split(path, ".")
+	return func(res *Response, _ error) bool {
+		if res == nil || res.Response == nil || res.Body == nil {
+			return false
+		}
+		if !res.IsReused {
+			if err := res.EnableMultiBodyReads(); err != nil {
+				return false
+			}
+		}
+		m, err := res.DecodeMap()
+		if nr, ok := res.Body.(*nopReadCloser); ok {
+			nr.rewind()
+		}
+		if err != nil {
+			return false
+		}
+		var v any = m
+		for _, k := range keys {
+			obj, ok := v.(map[string]any)
+			if !ok {
+				return false
+			}
+			if v, ok = obj[k]; !ok {
+				return false
+			}
+		}
+		return reflect.DeepEqual(v, want)
+	}
+}
+
+// RetryBudget is token bucket shared across requests of a client limiting the total number of
+// retries, so retries of many concurrent requests don't thunder against a rate limited API. Each
+// retry takes a token, if none is available the retry is skipped and the last response or error is
+// returned.
+type RetryBudget struct {
+	mu       sync.Mutex
+	tokens   float64
+	capacity float64
+	rate     float64 // tokens refilled per second
+	last     time.Time
+}
+
+// NewRetryBudget returns budget which allows bursts of capacity retries and refills at rate retries
+// per second.
+func NewRetryBudget(capacity int, rate float64) *RetryBudget {
+	return &RetryBudget{
+		tokens:   float64(capacity),
+		capacity: float64(capacity),
+		rate:     rate,
+		last:     time.Now(),
+	}
+}
+
+// Allow takes a token from the budget, it reports false if no token is available.
+func (b *RetryBudget) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// timerPool reuses retry wait timers across requests to avoid allocating a timer per retry.
+var timerPool sync.Pool
+
+func acquireTimer(d time.Duration) *time.Timer {
+	if t, ok := timerPool.Get().(*time.Timer); ok {
+		t.Reset(d)
+		return t
+	}
+	return time.NewTimer(d)
+}
+
+// releaseTimer stops t and returns it to the pool. Since Go 1.23 a stopped timer never delivers a
+// stale value so it's safe to reuse.
+func releaseTimer(t *time.Timer) {
+	t.Stop()
+	timerPool.Put(t)
+}
+
 const (
 	defaultWaitTime    = 100 * time.Millisecond
 	defaultMaxWaitTime = 3000 * time.Millisecond
@@ -54,6 +204,11 @@ type BackoffWithJitter struct {
 	prev     time.Duration // previous time for DecorrelatedJitter strategy
 	rnd      *rand.Rand
 	strategy JitterStrategy // JitterStrategy
+	// resetHeaders are headers carrying epoch seconds at which rate limit resets
+	resetHeaders []string
+	// HonorRetryAfterAlways respects Retry-After of any response, e.g. 403 used for rate limiting,
+	// instead of only 429 and 503 responses.
+	HonorRetryAfterAlways bool
 }
 
 func NewBackoffWithJitter(
@@ -74,18 +229,49 @@ func NewBackoffWithJitter(
 	}
 }
 
+// WithRateLimitResetHeaders makes the backoff wait until the epoch seconds carried by the first
+// present header, e.g. "X-RateLimit-Reset", when the response has no usable Retry-After. Only 429
+// responses and 403 responses carrying the header, as used by some APIs for rate limiting, are
+// considered. The wait is capped at the maximum wait of the backoff, backoff is used when none of
+// the headers is present.
+func (b *BackoffWithJitter) WithRateLimitResetHeaders(names ...string) *BackoffWithJitter {
+	b.resetHeaders = names
+	return b
+}
+
+// rateLimitReset returns the wait until rate limit resets based on reset headers.
+func (b *BackoffWithJitter) rateLimitReset(h http.Header) (time.Duration, bool) {
+	for _, name := range b.resetHeaders {
+		v := strings.TrimSpace(h.Get(name))
+		if v == "" {
+			continue
+		}
+		epoch, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || epoch < 0 {
+			continue
+		}
+		return max(0, time.Until(time.Unix(epoch, 0))), true
+	}
+	return 0, false
+}
+
 // NextWaitDuration return sleep times for retry to sleep
 func (b *BackoffWithJitter) NextWaitDuration(
 	res *Response,
 	attempt int,
 ) time.Duration {
 	if res != nil {
-		if res.StatusCode == http.StatusTooManyRequests ||
+		if b.HonorRetryAfterAlways || res.StatusCode == http.StatusTooManyRequests ||
 			res.StatusCode == http.StatusServiceUnavailable {
 			if delay, ok := ParseRetryHeader(res.Header.Get("Retry-After")); ok {
 				return delay
 			}
 		}
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusForbidden {
+			if delay, ok := b.rateLimitReset(res.Header); ok {
+				return min(delay, b.max)
+			}
+		}
 	}
 	// min(cap, base * 2**attempt)
 	exp := time.Duration(min(float64(b.max), float64(b.min)*math.Exp2(float64(attempt))))
@@ -132,6 +318,12 @@ func (b *BackoffWithJitter) balanceMinMax(delay time.Duration) time.Duration {
 
 // ParseRetryHeader parses the Retry-After header sent from server
 func ParseRetryHeader(v string) (time.Duration, bool) {
+	return ParseRetryHeaderAt(v, time.Now())
+}
+
+// ParseRetryHeaderAt is like [ParseRetryHeader] but HTTP-date values are resolved relative to now
+// instead of the current time, which makes parsing deterministic.
+func ParseRetryHeaderAt(v string, now time.Time) (time.Duration, bool) {
 	if strings.TrimSpace(v) == "" {
 		return 0, false
 	}
@@ -148,14 +340,24 @@ func ParseRetryHeader(v string) (time.Duration, bool) {
 		return 0, false
 	}
 
-	if until := time.Until(retryTime); until > 0 {
+	if until := retryTime.Sub(now); until > 0 {
 		return until, true
 	}
 	// date is in the past
 	return 0, true
 }
 
-func defaultRetryCondition(res *Response, err error) bool {
+// redirectRetryAfter returns the Retry-After wait of a 3xx response if enabled and redirects are
+// disabled.
+func (r *Retry) redirectRetryAfter(res *Response, redirectDisabled bool) (time.Duration, bool) {
+	if !r.RetryOnRedirectRetryAfter || !redirectDisabled || res == nil ||
+		res.StatusCode < 300 || res.StatusCode > 399 {
+		return 0, false
+	}
+	return ParseRetryHeader(res.Header.Get("Retry-After"))
+}
+
+func (r *Retry) defaultCondition(res *Response, err error) bool {
 	var (
 		certErr *tls.CertificateVerificationError
 		urlErr  *url.Error
@@ -178,9 +380,12 @@ func defaultRetryCondition(res *Response, err error) bool {
 		return false
 	}
 
+	if res.StatusCode == 0 {
+		return r.RetryOnZeroStatus
+	}
+
 	if res.StatusCode == http.StatusTooManyRequests ||
-		(res.StatusCode >= 500 && res.StatusCode != http.StatusNotImplemented) ||
-		res.StatusCode == 0 {
+		(res.StatusCode >= 500 && res.StatusCode != http.StatusNotImplemented) {
 		return true
 	}
 
@@ -0,0 +1,489 @@
+package httpxgo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTimerPoolReuse(t *testing.T) {
+	for range 3 {
+		timer := acquireTimer(time.Millisecond)
+		select {
+		case <-timer.C:
+		case <-time.After(time.Second):
+			t.Fatal("pooled timer did not fire")
+		}
+		releaseTimer(timer)
+	}
+	// A timer released before firing must not deliver a stale value once reused
+	releaseTimer(acquireTimer(time.Nanosecond))
+	time.Sleep(time.Millisecond)
+	timer := acquireTimer(time.Hour)
+	defer releaseTimer(timer)
+	select {
+	case <-timer.C:
+		t.Fatal("reused timer delivered a stale value")
+	default:
+	}
+}
+
+func BenchmarkRetryTimer(b *testing.B) {
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			timer := time.NewTimer(time.Hour)
+			timer.Stop()
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			releaseTimer(acquireTimer(time.Hour))
+		}
+	})
+}
+
+func TestBackoffRateLimitReset(t *testing.T) {
+	b := NewBackoffWithJitter(10*time.Millisecond, 10*time.Second, WithoutJitter).
+		WithRateLimitResetHeaders("X-RateLimit-Reset")
+	newResponse := func(status int, reset time.Time) *Response {
+		h := make(http.Header)
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		return &Response{Response: &http.Response{StatusCode: status, Header: h}}
+	}
+
+	soon := time.Now().Add(3 * time.Second)
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusForbidden} {
+		d := b.NextWaitDuration(newResponse(status, soon), 0)
+		if d < time.Second || d > 3*time.Second {
+			t.Errorf("%d: wait = %v, want until the reset in about 3s", status, d)
+		}
+	}
+	past := time.Now().Add(-time.Hour)
+	if d := b.NextWaitDuration(newResponse(http.StatusTooManyRequests, past), 0); d != 0 {
+		t.Errorf("past reset: wait = %v, want 0", d)
+	}
+
+	far := time.Now().Add(1000 * time.Hour)
+	if d := b.NextWaitDuration(newResponse(http.StatusTooManyRequests, far), 0); d != 10*time.Second {
+		t.Errorf("far reset: wait = %v, want capped at 10s", d)
+	}
+	// Other statuses use the backoff even if the header is present
+	if d := b.NextWaitDuration(newResponse(http.StatusBadGateway, far), 1); d != 20*time.Millisecond {
+		t.Errorf("502: wait = %v, want backoff of 20ms", d)
+	}
+}
+
+func TestRetryCount(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		retry *Retry
+		want  int32
+	}{
+		{&Retry{Count: 0}, 1},
+		{&Retry{Count: 1}, 2},
+		{&Retry{Count: 2}, 3},
+		{&Retry{Count: 2, CountIsRetries: true}, 3},
+	} {
+		hits.Store(0)
+		res, err := New().Get(srv.URL).SetRetry(tt.retry).Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if n := hits.Load(); n != tt.want {
+			t.Errorf("Count=%d CountIsRetries=%v: sent %d requests, want %d",
+				tt.retry.Count, tt.retry.CountIsRetries, n, tt.want)
+		}
+	}
+}
+
+func TestSetRetryIfDefaultRetry(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer srv.Close()
+
+	var hooked atomic.Int32
+	start := time.Now()
+	res, err := New().Get(srv.URL).
+		SetResponseHook(func(*Client, *Response) error {
+			hooked.Add(1)
+			return nil
+		}).
+		SetRetryIf(RetryOnStatus(http.StatusConflict)).
+		Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if n := hits.Load(); n != 4 {
+		t.Fatalf("sent %d requests, want 4 with the default of 3 retries", n)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Exec took %v, want the short default backoff", elapsed)
+	}
+	if n := hooked.Load(); n != 0 {
+		t.Fatalf("response hook ran %d times, want none with retry enabled", n)
+	}
+}
+
+func TestRetryOnRedirectRetryAfter(t *testing.T) {
+	var rootHits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/final" {
+			w.Write([]byte("final"))
+			return
+		}
+		if rootHits.Add(1) == 1 {
+			if r.URL.Path != "/nolocation" {
+				w.Header().Set("Location", "/final")
+			}
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTemporaryRedirect)
+			return
+		}
+		w.Write([]byte("root"))
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		name     string
+		c        *Client
+		path     string
+		option   bool
+		want     string
+		wantHits int32
+	}{
+		{"disabled redirects", New().DisableRedirect(), "/", true, "root", 2},
+		{"disabled redirects without option", New().DisableRedirect(), "/", false, "", 1},
+		{"enabled redirects", New(), "/", true, "final", 1},
+		// Without Location the 3xx is returned even with redirects enabled, it's not retried
+		{"enabled redirects without location", New(), "/nolocation", true, "", 1},
+	} {
+		rootHits.Store(0)
+		res, err := tt.c.Get(srv.URL + tt.path).
+			SetRetry(&Retry{Count: 1, RetryOnRedirectRetryAfter: tt.option}).
+			Exec()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, _ := res.String()
+		res.Body.Close()
+		if got != tt.want || rootHits.Load() != tt.wantHits {
+			t.Errorf("%s: body = %q after %d requests, want %q after %d",
+				tt.name, got, rootHits.Load(), tt.want, tt.wantHits)
+		}
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestRetryZeroStatus(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		err           error
+		retryOnZero   bool
+		wantAttempts  int32
+		wantExecError bool
+	}{
+		{"zero status without error", nil, false, 1, false},
+		{"zero status without error retried", nil, true, 3, false},
+		{"zero status with error", errors.New("connection reset"), false, 1, true},
+		{"zero status with error and option", errors.New("connection reset"), true, 1, true},
+	} {
+		var attempts atomic.Int32
+		c := New().SetTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			attempts.Add(1)
+			if tt.err != nil {
+				return nil, tt.err
+			}
+			return &http.Response{Header: make(http.Header), Body: http.NoBody, Request: r}, nil
+		}))
+		res, err := c.Get("http://example.test").
+			SetRetry(&Retry{Count: 2, Wait: time.Millisecond, RetryOnZeroStatus: tt.retryOnZero}).
+			Exec()
+		if (err != nil) != tt.wantExecError {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+		if res != nil && res.Body != nil {
+			res.Body.Close()
+		}
+		if n := attempts.Load(); n != tt.wantAttempts {
+			t.Errorf("%s: %d attempts, want %d", tt.name, n, tt.wantAttempts)
+		}
+	}
+}
+
+func TestAttemptsReusedConn(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	res, err := New().Get(srv.URL).EnableTrace().
+		SetRetry(&Retry{Count: 2, Wait: time.Millisecond}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	// First attempt dials, retries reuse the connection released by the previous attempt
+	if want := []bool{false, true, true}; !slices.Equal(res.AttemptsReusedConn, want) {
+		t.Fatalf("AttemptsReusedConn = %v, want %v", res.AttemptsReusedConn, want)
+	}
+	if len(res.AttemptDurations) != 3 {
+		t.Fatalf("AttemptDurations = %v, want one per attempt", res.AttemptDurations)
+	}
+}
+
+func TestRetryBudgetConcurrent(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// No refill during the test, the whole budget is 5 retries
+	c := New().SetRetryBudget(NewRetryBudget(5, 0))
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			res, err := c.Get(srv.URL).SetRetry(&Retry{Count: 3, Wait: time.Millisecond}).Exec()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			res.Body.Close()
+		})
+	}
+	wg.Wait()
+	// 10 first attempts plus the 5 retries granted by the budget
+	if n := hits.Load(); n != 15 {
+		t.Fatalf("server hits = %d, want 15", n)
+	}
+	if c.retryBudget.Allow() {
+		t.Fatal("budget still has tokens")
+	}
+}
+
+func TestParseRetryHeaderAt(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		v      string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"Fri, 01 Mar 2024 12:01:30 GMT", 90 * time.Second, true},
+		{"Sat, 02 Mar 2024 12:00:00 GMT", 24 * time.Hour, true},
+		{"Fri, 01 Mar 2024 11:00:00 GMT", 0, true},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseRetryHeaderAt(tt.v, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ParseRetryHeaderAt(%q) = %v, %v, want %v, %v", tt.v, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestRetryWithJitter(t *testing.T) {
+	retry := NewRetry().WithJitter(time.Millisecond, 4*time.Millisecond, FullJitter)
+	b := retry.Backoff
+	if b == nil || b.min != time.Millisecond || b.max != 4*time.Millisecond ||
+		b.strategy != FullJitter {
+		t.Fatalf("Backoff = %+v, want full jitter between 1ms and 4ms", b)
+	}
+	for attempt := range 5 {
+		if d := b.NextWaitDuration(nil, attempt); d < b.min || d > b.max {
+			t.Fatalf("attempt %d waits %v, want between %v and %v", attempt, d, b.min, b.max)
+		}
+	}
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// The jittered backoff replaces the static 20s wait of NewRetry
+	retry.Count = 2
+	start := time.Now()
+	res, err := New().Get(srv.URL).SetRetry(retry).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if n := hits.Load(); n != 3 {
+		t.Fatalf("sent %d requests, want 3", n)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Exec took %v, want the jittered backoff instead of the static wait", elapsed)
+	}
+}
+
+func TestAttemptDurations(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		if hits.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	res, err := New().Get(srv.URL).SetRetry(&Retry{Count: 3, Wait: time.Millisecond}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if n := int(hits.Load()); len(res.AttemptDurations) != n {
+		t.Fatalf("AttemptDurations = %v, want one per %d attempts", res.AttemptDurations, n)
+	}
+	for i, d := range res.AttemptDurations {
+		if d < 5*time.Millisecond {
+			t.Fatalf("attempt %d took %v, want at least the server delay", i+1, d)
+		}
+	}
+
+	// Single attempt without retry
+	res, err = New().Get(srv.URL).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if len(res.AttemptDurations) != 1 || res.AttemptDurations[0] <= 0 {
+		t.Fatalf("AttemptDurations = %v, want a single positive duration", res.AttemptDurations)
+	}
+}
+
+func TestRetryMaxElapsedTime(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	retry := &Retry{Count: 100, Wait: 40 * time.Millisecond, MaxElapsedTime: 100 * time.Millisecond}
+	start := time.Now()
+	res, err := New().Get(srv.URL).SetRetry(retry).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	elapsed := time.Since(start)
+	if elapsed > 100*time.Millisecond+time.Second {
+		t.Fatalf("Exec took %v, want it bounded by MaxElapsedTime", elapsed)
+	}
+	// Attempts at 0, 40 and 80ms, the next one would start after 100ms
+	if n := hits.Load(); n < 2 || n > 3 {
+		t.Fatalf("sent %d requests, want the time bound to stop retries before Count", n)
+	}
+
+	// Count still wins when it's hit first
+	hits.Store(0)
+	res, err = New().Get(srv.URL).
+		SetRetry(&Retry{Count: 1, Wait: time.Millisecond, MaxElapsedTime: time.Hour}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if n := hits.Load(); n != 2 {
+		t.Fatalf("sent %d requests, want 2 bounded by Count", n)
+	}
+}
+
+func TestOnRetry(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) < 4 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	var attempts []int
+	onRetry := func(res *Response, err error, attempt int, wait time.Duration) {
+		if err != nil || res == nil || res.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("attempt %d: res = %v, err = %v, want the failed 503", attempt, res, err)
+		}
+		if wait != 2*time.Millisecond {
+			t.Errorf("attempt %d: wait = %v, want the computed 2ms", attempt, wait)
+		}
+		// Called before the next attempt is sent
+		if n := int(hits.Load()); n != attempt {
+			t.Errorf("attempt %d: called after %d requests", attempt, n)
+		}
+		attempts = append(attempts, attempt)
+	}
+	res, err := New().Get(srv.URL).
+		SetRetry(&Retry{Count: 5, Wait: 2 * time.Millisecond, OnRetry: onRetry}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if want := []int{1, 2, 3}; !slices.Equal(attempts, want) {
+		t.Fatalf("OnRetry attempts = %v, want %v", attempts, want)
+	}
+}
+
+func TestHonorRetryAfterAlways(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	for _, honor := range []bool{true, false} {
+		backoff := NewBackoffWithJitter(time.Millisecond, 5*time.Millisecond, FullJitter)
+		backoff.HonorRetryAfterAlways = honor
+		// The wait is recorded and the request cancelled instead of sleeping
+		ctx, cancel := context.WithCancel(context.Background())
+		var wait time.Duration
+		retry := &Retry{
+			Count:   1,
+			Backoff: backoff,
+			Cond:    func(res *Response, err error) bool { return res.StatusCode == http.StatusForbidden },
+			OnRetry: func(_ *Response, _ error, _ int, d time.Duration) {
+				wait = d
+				cancel()
+			},
+		}
+		New().Get(srv.URL).WithContext(ctx).SetRetry(retry).Exec()
+		cancel()
+		if honor && wait != 7*time.Second {
+			t.Errorf("enabled: wait = %v, want Retry-After of 7s on 403", wait)
+		}
+		if !honor && (wait < time.Millisecond || wait > 5*time.Millisecond) {
+			t.Errorf("disabled: wait = %v, want backoff ignoring Retry-After on 403", wait)
+		}
+	}
+}
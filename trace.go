@@ -12,12 +12,17 @@ type TraceInfo struct {
 	// DNSLookup is the duration that transport took to perform
 	// DNS lookup.
 	DNSLookup time.Duration `json:"dns_lookup_time"`
+	// DNSAddrs are the addresses resolved by DNS lookup.
+	DNSAddrs []string `json:"dns_addresses"`
 	// ConnTime is the duration it took to obtain a successful connection.
 	ConnTime time.Duration `json:"connection_time"`
 	// TCPConnTime is the duration it took to obtain the TCP connection.
 	TCPConnTime time.Duration `json:"tcp_connection_time"`
 	// TLSHandshake is the duration of the TLS handshake.
 	TLSHandshake time.Duration `json:"tls_handshake_time"`
+	// WroteRequest is the duration it took to write the request including the body after
+	// obtaining the connection.
+	WroteRequest time.Duration `json:"wrote_request_time"`
 	// ServerTime is the server's duration for responding to the first byte.
 	ServerTime time.Duration `json:"server_time"`
 	// ResponseTime is the duration since the first response byte from the server to
@@ -42,17 +47,19 @@ type TraceInfo struct {
 func (ti *TraceInfo) String() string {
 	return fmt.Sprintf(`TRACE INFO:
   DNSLookupTime : %v
+  DNSAddrs      : %v
   ConnTime      : %v
   TCPConnTime   : %v
   TLSHandshake  : %v
+  WroteRequest  : %v
   ServerTime    : %v
   ResponseTime  : %v
   TotalTime     : %v
   IsConnReused  : %v
   IsConnWasIdle : %v
   ConnIdleTime  : %v
-  RemoteAddr    : %v`, ti.DNSLookup, ti.ConnTime, ti.TCPConnTime,
-		ti.TLSHandshake, ti.ServerTime, ti.ResponseTime, ti.TotalTime,
+  RemoteAddr    : %v`, ti.DNSLookup, ti.DNSAddrs, ti.ConnTime, ti.TCPConnTime,
+		ti.TLSHandshake, ti.WroteRequest, ti.ServerTime, ti.ResponseTime, ti.TotalTime,
 		ti.IsConnReused, ti.IsConnWasIdle, ti.ConnIdleTime, ti.RemoteAddr)
 }
 
@@ -62,8 +69,12 @@ func (ti *TraceInfo) Tracer(ctx context.Context) context.Context {
 		DNSStart: func(_ httptrace.DNSStartInfo) {
 			dnsStart = time.Now()
 		},
-		DNSDone: func(_ httptrace.DNSDoneInfo) {
+		DNSDone: func(info httptrace.DNSDoneInfo) {
 			ti.DNSLookup = time.Since(dnsStart)
+			ti.DNSAddrs = ti.DNSAddrs[:0]
+			for _, addr := range info.Addrs {
+				ti.DNSAddrs = append(ti.DNSAddrs, addr.String())
+			}
 		},
 		ConnectStart: func(_, _ string) {
 			connectSart = time.Now()
@@ -75,12 +86,15 @@ func (ti *TraceInfo) Tracer(ctx context.Context) context.Context {
 			getConn = time.Now()
 		},
 		GotConn: func(gci httptrace.GotConnInfo) {
-			gotConn := time.Now()
+			gotConn = time.Now()
 			ti.ConnTime = gotConn.Sub(getConn)
 			ti.RemoteAddr = gci.Conn.RemoteAddr().String()
 			ti.ConnIdleTime = gci.IdleTime
 			ti.IsConnReused = gci.Reused
 		},
+		WroteRequest: func(_ httptrace.WroteRequestInfo) {
+			ti.WroteRequest = time.Since(gotConn)
+		},
 		GotFirstResponseByte: func() {
 			ti.ServerTime = time.Since(gotConn)
 		},
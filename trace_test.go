@@ -0,0 +1,83 @@
+package httpxgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowReader yields chunks of zeros pausing before each of them.
+type slowReader struct {
+	chunks int
+	pause  time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if r.chunks == 0 {
+		return 0, io.EOF
+	}
+	r.chunks--
+	time.Sleep(r.pause)
+	n := min(len(p), 64<<10)
+	clear(p[:n])
+	return n, nil
+}
+
+func TestTraceWroteRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer srv.Close()
+
+	res, err := New().Post(srv.URL, nil).EnableTrace().
+		SetBody(&slowReader{chunks: 5, pause: 20 * time.Millisecond}).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	ti, err := res.TraceInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti.WroteRequest < 100*time.Millisecond {
+		t.Fatalf("WroteRequest = %v, want at least the upload time of 100ms", ti.WroteRequest)
+	}
+	if ti.WroteRequest > ti.ServerTime {
+		t.Fatalf("WroteRequest = %v exceeds ServerTime = %v", ti.WroteRequest, ti.ServerTime)
+	}
+	if !strings.Contains(ti.String(), "WroteRequest  : "+ti.WroteRequest.String()) {
+		t.Fatalf("String() is missing WroteRequest:\n%s", ti)
+	}
+	b, _ := json.Marshal(ti)
+	var m map[string]any
+	json.Unmarshal(b, &m)
+	if m["wrote_request_time"] != float64(ti.WroteRequest) {
+		t.Fatalf("JSON wrote_request_time = %v, want %d", m["wrote_request_time"], ti.WroteRequest)
+	}
+}
+
+func TestTraceDNSAddrs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	res, err := New().Get("http://localhost:" + port).EnableTrace().Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	ti, _ := res.TraceInfo()
+	if !slices.ContainsFunc(ti.DNSAddrs, func(a string) bool { return net.ParseIP(a).IsLoopback() }) {
+		t.Fatalf("DNSAddrs = %v, want a loopback address", ti.DNSAddrs)
+	}
+	if !strings.Contains(ti.String(), "DNSAddrs      : "+fmt.Sprint(ti.DNSAddrs)) {
+		t.Fatalf("String() is missing DNSAddrs:\n%s", ti)
+	}
+}
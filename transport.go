@@ -1,8 +1,11 @@
 package httpxgo
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
 	"net"
 	"net/http"
 	"net/url"
@@ -19,10 +22,7 @@ const (
 )
 
 var defaultTransport = &http.Transport{
-	DialContext: transportDailContext(),
-	TLSClientConfig: &tls.Config{
-		InsecureSkipVerify: true,
-	},
+	DialContext:           transportDailContext(),
 	MaxIdleConns:          maxIdleConns,
 	MaxIdleConnsPerHost:   maxIdleConnsPerHost,
 	IdleConnTimeout:       idleConnTimeout,
@@ -35,12 +35,16 @@ var defaultTransport = &http.Transport{
 
 // SetProxy set proxy to defaultTransport.
 // if you're using custom transport it is assumed that you have provide proxy with it.
+//
+// Deprecated: It affects every client using the default transport, use [Client.SetProxy].
 func SetProxy(proxy func(r *http.Request) (*url.URL, error)) {
 	defaultTransport.Proxy = proxy
 }
 
 // SetSocket function used for connecting to various different socket such as unix, ip. tcp, ipv4,
 // ipv6
+//
+// Deprecated: It affects every client using the default transport, use [Client.SetSocketDialer].
 func SetSocket(f func(ctx context.Context, network, addr string) (net.Conn, error)) {
 	defaultTransport.DialContext = f
 }
@@ -54,8 +58,30 @@ func GetDefaultTransport() *http.Transport {
 // transportDailContext return DailContext Func for setting it in transport.
 // usable for field such as DialContext and DialTLSContext.
 func transportDailContext() func(context.Context, string, string) (net.Conn, error) {
-	return (&net.Dialer{
+	return newDialer().DialContext
+}
+
+// newDialer returns dialer with the default dial timeout and keep alive period.
+func newDialer() *net.Dialer {
+	return &net.Dialer{
 		Timeout:   30 * time.Second,
 		KeepAlive: 30 * time.Second,
-	}).DialContext
+	}
+}
+
+// verifyCertPins returns [tls.Config.VerifyPeerCertificate] func which accepts the connection only
+// if SHA-256 fingerprint of the leaf certificate matches one of the pins.
+func verifyCertPins(pins [][]byte) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("httpx: no peer certificate to verify pin")
+		}
+		sum := sha256.Sum256(rawCerts[0])
+		for _, pin := range pins {
+			if bytes.Equal(pin, sum[:]) {
+				return nil
+			}
+		}
+		return errors.New("httpx: peer certificate does not match any pin")
+	}
 }
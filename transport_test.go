@@ -0,0 +1,204 @@
+package httpxgo
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCertPinning(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	c := New().SetTransport(srv.Client().Transport)
+	pin := sha256.Sum256(srv.Certificate().Raw)
+
+	res, err := c.Get(srv.URL).SetCertPinning([][]byte{pin[:]}).Exec()
+	if err != nil {
+		t.Fatalf("matching pin: %v", err)
+	}
+	res.Body.Close()
+	if res.TLSState() == nil || res.TLS == nil {
+		t.Fatal("TLS state is missing")
+	}
+	if certs := res.PeerCertificates(); len(certs) == 0 || !certs[0].Equal(srv.Certificate()) {
+		t.Fatal("leaf certificate does not match the server certificate")
+	}
+
+	other := sha256.Sum256([]byte("other"))
+	if _, err := c.Get(srv.URL).SetCertPinning([][]byte{other[:]}).Exec(); err == nil {
+		t.Fatal("non-matching pin: want error")
+	}
+}
+
+func TestTLSStateWithoutResponse(t *testing.T) {
+	var res *Response
+	if res.TLSState() != nil || res.PeerCertificates() != nil {
+		t.Fatal("want nil for nil response")
+	}
+	if (&Response{}).PeerCertificates() != nil {
+		t.Fatal("want nil for response without http.Response")
+	}
+}
+
+func TestTLSVerifiedByDefault(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	if _, err := New().Get(srv.URL).Exec(); err == nil {
+		t.Fatal("self-signed certificate accepted by default")
+	}
+	res, err := New().SetInsecureSkipVerify(true).Get(srv.URL).Exec()
+	if err != nil {
+		t.Fatalf("insecure client: %v", err)
+	}
+	res.Body.Close()
+	// Opting out on one client must not affect others
+	if _, err := New().Get(srv.URL).Exec(); err == nil {
+		t.Fatal("self-signed certificate accepted by another client")
+	}
+}
+
+func TestClientProxiesAreIndependent(t *testing.T) {
+	newProxy := func(name string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s", name, r.Host)
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	proxyURL := func(srv *httptest.Server) func(*http.Request) (*url.URL, error) {
+		u, _ := url.Parse(srv.URL)
+		return http.ProxyURL(u)
+	}
+	a, b := newProxy("a"), newProxy("b")
+	ca := New().SetProxy(proxyURL(a))
+	cb := New().SetProxy(proxyURL(b))
+
+	for _, tt := range []struct {
+		c    *Client
+		want string
+	}{{ca, "a example.test"}, {cb, "b example.test"}, {ca, "a example.test"}} {
+		res, err := tt.c.Get("http://example.test/").Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := res.String()
+		res.Body.Close()
+		if got != tt.want {
+			t.Fatalf("routed through %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestVariantIdleConnsClosedOnReconfigure(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	c := New()
+	res, err := c.Get(srv.URL).SetNoProxy().Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Close()
+
+	// Reconfiguring the transport drops the variant along with its idle connection
+	c.SetDialTimeout(time.Second)
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("idle connection of the replaced variant was not closed")
+	}
+}
+
+func TestSetNoProxy(t *testing.T) {
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		w.Write([]byte("proxy"))
+	}))
+	defer proxy.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("direct"))
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(proxy.URL)
+	c := New().SetProxy(http.ProxyURL(u))
+	for _, tt := range []struct {
+		noProxy bool
+		want    string
+	}{{false, "proxy"}, {true, "direct"}, {false, "proxy"}} {
+		req := c.Get(srv.URL)
+		if tt.noProxy {
+			req.SetNoProxy()
+		}
+		res, err := req.Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := res.String()
+		res.Body.Close()
+		if got != tt.want {
+			t.Fatalf("noProxy=%v: answered by %s, want %s", tt.noProxy, got, tt.want)
+		}
+	}
+	if n := proxied.Load(); n != 2 {
+		t.Fatalf("proxy received %d requests, want 2", n)
+	}
+}
+
+func TestSetResponseHeaderTimeout(t *testing.T) {
+	stop := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-stop:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(stop)
+
+	start := time.Now()
+	_, err := New().SetResponseHeaderTimeout(50 * time.Millisecond).Get(srv.URL).Exec()
+	if err == nil || !strings.Contains(err.Error(), "timeout awaiting response headers") {
+		t.Fatalf("err = %v, want response header timeout", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("request failed after %v, want promptly after the timeout", d)
+	}
+}
+
+func TestSetDialTimeout(t *testing.T) {
+	c := New().SetDialTimeout(50 * time.Millisecond).SetKeepAlivePeriod(-1)
+	if c.dialer.Timeout != 50*time.Millisecond || c.dialer.KeepAlive != -1 {
+		t.Fatalf("dialer timeout = %v keep-alive = %v", c.dialer.Timeout, c.dialer.KeepAlive)
+	}
+
+	// 10.255.255.1 is not routed, the dial hangs until the timeout
+	start := time.Now()
+	_, err := c.Get("http://10.255.255.1").Exec()
+	if err == nil {
+		t.Fatal("want dial error for unroutable address")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("dial failed after %v, want promptly after the timeout", d)
+	}
+}
@@ -4,25 +4,67 @@ import (
 	"compress/flate"
 	"compress/gzip"
 	"compress/zlib"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
 	"io"
+	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 )
 
 type (
 	ResponseHook     func(*Client, *Response) error
 	RequestHook      func(*Client, *Request) error
+	ErrorHook        func(*Request, error)
 	ContentTypeEncFn func(body any) (io.Reader, error)
 	ContentTypeDecFn func(body any, r io.Reader) error
-	DecompressFn     func(io.ReadCloser) (io.ReadCloser, error)
+	// ContentTypeDecMatcherFn resolves a decoder for media types that have no exact match, such as
+	// "text/*" or any type ending in "+json".
+	ContentTypeDecMatcherFn func(mediaType string) (ContentTypeDecFn, bool)
+	DecompressFn            func(io.ReadCloser) (io.ReadCloser, error)
+	CompressFn              func(io.Writer) (io.WriteCloser, error)
 )
 
+// Logger receives internal diagnostics of the client such as retry decisions, circuit breaker
+// transitions and decompression choices. keyvals are alternating keys and values.
+type Logger interface {
+	Debug(msg string, keyvals ...any)
+	Warn(msg string, keyvals ...any)
+}
+
 type contentTypeEncoders struct {
 	mu  sync.RWMutex
 	enc map[string]ContentTypeEncFn
 }
 
 func newContentTypeEncoders() *contentTypeEncoders {
-	return &contentTypeEncoders{enc: make(map[string]ContentTypeEncFn)}
+	return &contentTypeEncoders{enc: map[string]ContentTypeEncFn{
+		contentTypeForm: encodeForm,
+	}}
+}
+
+// encodeForm encodes [url.Values] or maps of strings as application/x-www-form-urlencoded.
+func encodeForm(body any) (io.Reader, error) {
+	var vals url.Values
+	switch v := body.(type) {
+	case url.Values:
+		vals = v
+	case map[string][]string:
+		vals = v
+	case map[string]string:
+		vals = make(url.Values, len(v))
+		for k, val := range v {
+			vals.Set(k, val)
+		}
+	default:
+		return nil, fmt.Errorf("form encoder does not support %T", body)
+	}
+	return strings.NewReader(vals.Encode()), nil
 }
 
 func (ce *contentTypeEncoders) set(key string, fn ContentTypeEncFn) {
@@ -39,12 +81,18 @@ func (ce *contentTypeEncoders) get(key string) (ContentTypeEncFn, bool) {
 }
 
 type contentTypeDecoders struct {
-	mu  sync.RWMutex
-	dec map[string]ContentTypeDecFn
+	mu       sync.RWMutex
+	dec      map[string]ContentTypeDecFn
+	matchers []ContentTypeDecMatcherFn
 }
 
 func newContentTypeDecoders() *contentTypeDecoders {
-	return &contentTypeDecoders{dec: make(map[string]ContentTypeDecFn)}
+	return &contentTypeDecoders{
+		dec: map[string]ContentTypeDecFn{
+			contentTypeJSON: decodeJSON,
+			contentTypeXML:  decodeXML,
+		},
+	}
 }
 
 func (ce *contentTypeDecoders) set(key string, fn ContentTypeDecFn) {
@@ -53,15 +101,30 @@ func (ce *contentTypeDecoders) set(key string, fn ContentTypeDecFn) {
 	ce.mu.Unlock()
 }
 
+func (ce *contentTypeDecoders) setMatcher(fn ContentTypeDecMatcherFn) {
+	ce.mu.Lock()
+	ce.matchers = append(ce.matchers, fn)
+	ce.mu.Unlock()
+}
+
+// get returns the decoder registered for key, exact matches take precedence over matchers which
+// are consulted in the order they were registered.
 func (ce *contentTypeDecoders) get(key string) (ContentTypeDecFn, bool) {
 	ce.mu.RLock()
-	fn, ok := ce.dec[key]
-	ce.mu.RUnlock()
-	return fn, ok
+	defer ce.mu.RUnlock()
+	if fn, ok := ce.dec[key]; ok {
+		return fn, ok
+	}
+	for _, m := range ce.matchers {
+		if fn, ok := m(key); ok && fn != nil {
+			return fn, true
+		}
+	}
+	return nil, false
 }
 
 // contentTypeDecompressor is concurrent safe map of decompression function.
-// It already has gzip, delfate and zlib. User can override it as well.
+// It already has gzip, deflate, zlib, br and zstd. User can override it as well.
 type contentTypeDecompressor struct {
 	mu   sync.RWMutex
 	data map[string]DecompressFn
@@ -73,6 +136,8 @@ func newDecompressor() *contentTypeDecompressor {
 			"gzip":    decompressGzip,
 			"deflate": decompressFlate,
 			"zlib":    decompressZlib,
+			"br":      decompressBrotli,
+			"zstd":    decompressZstd,
 		},
 	}
 }
@@ -90,6 +155,48 @@ func (ds *contentTypeDecompressor) get(key string) (fn DecompressFn, ok bool) {
 	return fn, ok
 }
 
+// contentTypeCompressor is concurrent safe map of request body compression function.
+// It already has gzip, deflate and zlib matching the default decompressors.
+type contentTypeCompressor struct {
+	mu   sync.RWMutex
+	data map[string]CompressFn
+}
+
+func newCompressor() *contentTypeCompressor {
+	return &contentTypeCompressor{
+		data: map[string]CompressFn{
+			"gzip":    compressGzip,
+			"deflate": compressFlate,
+			"zlib":    compressZlib,
+		},
+	}
+}
+
+func (cs *contentTypeCompressor) put(key string, fn CompressFn) {
+	cs.mu.Lock()
+	cs.data[key] = fn
+	cs.mu.Unlock()
+}
+
+func (cs *contentTypeCompressor) get(key string) (fn CompressFn, ok bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	fn, ok = cs.data[key]
+	return fn, ok
+}
+
+func compressGzip(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func compressFlate(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, flate.DefaultCompression)
+}
+
+func compressZlib(w io.Writer) (io.WriteCloser, error) {
+	return zlib.NewWriter(w), nil
+}
+
 type decompressor struct {
 	s io.ReadCloser
 	r io.Reader
@@ -99,19 +206,63 @@ func (d *decompressor) Read(p []byte) (int, error) {
 	return d.r.Read(p)
 }
 
+// Close closes the format reader if it's an [io.Closer] along with the underlying body.
 func (d *decompressor) Close() error {
-	return d.s.Close()
+	var err error
+	if c, ok := d.r.(io.Closer); ok {
+		err = c.Close()
+	}
+	if serr := d.s.Close(); serr != nil {
+		return serr
+	}
+	return err
 }
 
+// gzipReaderPool reuses gzip readers across responses, gzip.NewReader allocates sizeable state.
+var gzipReaderPool sync.Pool
+
 func decompressGzip(r io.ReadCloser) (io.ReadCloser, error) {
-	gr, err := gzip.NewReader(r)
-	if err != nil {
-		return nil, err
+	gr, ok := gzipReaderPool.Get().(*gzip.Reader)
+	if ok {
+		if err := gr.Reset(r); err != nil {
+			gzipReaderPool.Put(gr)
+			return nil, err
+		}
+	} else {
+		var err error
+		if gr, err = gzip.NewReader(r); err != nil {
+			return nil, err
+		}
+	}
+	return &gzipDecompressor{s: r, gr: gr}, nil
+}
+
+// gzipDecompressor returns its gzip reader to the pool once closed.
+type gzipDecompressor struct {
+	mu sync.Mutex
+	s  io.ReadCloser
+	gr *gzip.Reader
+}
+
+func (d *gzipDecompressor) Read(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.gr == nil {
+		return 0, http.ErrBodyReadAfterClose
 	}
-	return &decompressor{
-		s: r,
-		r: gr,
-	}, nil
+	return d.gr.Read(p)
+}
+
+// Close closes the source first so a blocked Read returns before the reader is pooled.
+func (d *gzipDecompressor) Close() error {
+	err := d.s.Close()
+	d.mu.Lock()
+	if d.gr != nil {
+		gzipReaderPool.Put(d.gr)
+		d.gr = nil
+	}
+	d.mu.Unlock()
+	return err
 }
 
 func decompressFlate(r io.ReadCloser) (io.ReadCloser, error) {
@@ -125,3 +276,25 @@ func decompressZlib(r io.ReadCloser) (io.ReadCloser, error) {
 	}
 	return &decompressor{s: r, r: zr}, nil
 }
+
+func decompressBrotli(r io.ReadCloser) (io.ReadCloser, error) {
+	return &decompressor{s: r, r: brotli.NewReader(r)}, nil
+}
+
+// decompressZstd decodes on the calling goroutine, the default concurrency spawns background
+// workers per reader which isn't worth it for a single response body.
+func decompressZstd(r io.ReadCloser) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &decompressor{s: r, r: zr.IOReadCloser()}, nil
+}
+
+func decodeJSON(body any, r io.Reader) error {
+	return json.NewDecoder(r).Decode(body)
+}
+
+func decodeXML(body any, r io.Reader) error {
+	return xml.NewDecoder(r).Decode(body)
+}
@@ -0,0 +1,345 @@
+package httpxgo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipBytes(t testing.TB, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPooledGzipConcurrent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(gzipBytes(t, bytes.Repeat([]byte(r.URL.Query().Get("v")), 4096)))
+	}))
+	defer srv.Close()
+
+	c := New()
+	var wg sync.WaitGroup
+	for i := range 64 {
+		wg.Go(func() {
+			v := fmt.Sprintf("resp-%d;", i)
+			res, err := c.Get(srv.URL).SetQuery("v", v).SetHeader("Accept-Encoding", "gzip").Exec()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer res.Body.Close()
+			got, err := res.Bytes()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !bytes.Equal(got, bytes.Repeat([]byte(v), 4096)) {
+				t.Errorf("response %d: body decoded by a reused reader does not match", i)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func TestPooledGzipReadAfterClose(t *testing.T) {
+	rc, err := decompressGzip(io.NopCloser(bytes.NewReader(gzipBytes(t, []byte("httpx")))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	if _, err := rc.Read(make([]byte, 8)); err != http.ErrBodyReadAfterClose {
+		t.Fatalf("err = %v, want ErrBodyReadAfterClose", err)
+	}
+	// Closing twice must not put the reader into the pool twice
+	rc.Close()
+}
+
+func TestDecompressBrotliZstd(t *testing.T) {
+	want := bytes.Repeat([]byte("httpx-go "), 2048)
+	encode := map[string]func(io.Writer) io.WriteCloser{
+		"br": func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+		"zstd": func(w io.Writer) io.WriteCloser {
+			zw, err := zstd.NewWriter(w)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return zw
+		},
+	}
+	for enc, newWriter := range encode {
+		t.Run(enc, func(t *testing.T) {
+			var buf bytes.Buffer
+			zw := newWriter(&buf)
+			zw.Write(want)
+			if err := zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", enc)
+				w.Write(buf.Bytes())
+			}))
+			defer srv.Close()
+
+			res, err := New().Get(srv.URL).SetHeader("Accept-Encoding", enc).Exec()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			got, err := res.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("decoded %d bytes, want %d matching bytes", len(got), len(want))
+			}
+		})
+	}
+}
+
+type closeCounter struct {
+	io.Reader
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestDecompressorClosesSource(t *testing.T) {
+	var buf bytes.Buffer
+	zw, _ := zstd.NewWriter(&buf)
+	zw.Write([]byte("httpx"))
+	zw.Close()
+
+	src := &closeCounter{Reader: &buf}
+	rc, err := decompressZstd(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if src.closed != 1 {
+		t.Fatalf("source closed %d times, want 1", src.closed)
+	}
+	// The format reader is closed as well, a zstd decoder refuses reads afterwards
+	if _, err := rc.Read(make([]byte, 8)); err == nil {
+		t.Fatal("read after close succeeded")
+	}
+}
+
+func BenchmarkDecompressGzip(b *testing.B) {
+	body := gzipBytes(b, bytes.Repeat([]byte("httpx"), 1024))
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			zr, _ := gzip.NewReader(bytes.NewReader(body))
+			io.Copy(io.Discard, zr)
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			rc, _ := decompressGzip(io.NopCloser(bytes.NewReader(body)))
+			io.Copy(io.Discard, rc)
+			rc.Close()
+		}
+	})
+}
+
+func TestPreserveEncodingHeaders(t *testing.T) {
+	body := gzipBytes(t, []byte("httpx"))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	for _, preserve := range []bool{true, false} {
+		res, err := New().SetPreserveEncodingHeaders(preserve).Get(srv.URL).
+			SetHeader("Accept-Encoding", "gzip").Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := res.String()
+		res.Body.Close()
+		if got != "httpx" {
+			t.Fatalf("preserve=%v: body = %q, want it decompressed", preserve, got)
+		}
+		enc, length := res.Header.Get("Content-Encoding"), res.Header.Get("Content-Length")
+		if preserve && (enc != "gzip" || length != strconv.Itoa(len(body))) {
+			t.Errorf("preserve=true: Content-Encoding = %q, Content-Length = %q, want originals",
+				enc, length)
+		}
+		if !preserve && (enc != "" || length != "") {
+			t.Errorf("preserve=false: Content-Encoding = %q, Content-Length = %q, want removed",
+				enc, length)
+		}
+	}
+}
+
+func TestRequestDecompressor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "x-upper")
+		w.Write([]byte("HTTPX"))
+	}))
+	defer srv.Close()
+
+	lower := func(r io.ReadCloser) (io.ReadCloser, error) {
+		b, err := io.ReadAll(r)
+		r.Close()
+		return io.NopCloser(bytes.NewReader(bytes.ToLower(b))), err
+	}
+	c := New()
+	res, err := c.Get(srv.URL).SetHeader("Accept-Encoding", "x-upper").
+		SetDecompressor("x-upper", lower).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := res.String()
+	res.Body.Close()
+	if got != "httpx" {
+		t.Fatalf("body = %q, want it decoded by the request decompressor", got)
+	}
+
+	// Client decompressors are unaffected by the request override
+	if _, ok := c.decompressors.get("x-upper"); ok {
+		t.Fatal("request decompressor leaked into the client")
+	}
+	if _, err := c.Get(srv.URL).SetHeader("Accept-Encoding", "x-upper").Exec(); err == nil {
+		t.Fatal("want error for an encoding without decompressor")
+	}
+}
+
+func TestDecompressFallback(t *testing.T) {
+	const page = "<h1>internal error</h1>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Header claims gzip but the error page is sent as is
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	if _, err := New().Get(srv.URL).SetHeader("Accept-Encoding", "gzip").Exec(); err == nil {
+		t.Fatal("want decompression error without fallback")
+	}
+
+	res, err := New().SetDecompressFallback(true).Get(srv.URL).
+		SetHeader("Accept-Encoding", "gzip").Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	got, err := res.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusInternalServerError || got != page {
+		t.Fatalf("status = %d body = %q, want 500 with the raw body", res.StatusCode, got)
+	}
+	if res.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatal("Content-Encoding removed from the raw body")
+	}
+}
+
+func TestChainedContentEncoding(t *testing.T) {
+	want := bytes.Repeat([]byte("httpx-go "), 512)
+	writers := map[string]func(io.Writer) io.WriteCloser{
+		"gzip": func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"zlib": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"br":   func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+	}
+	// encode applies the encodings in the order they are listed in Content-Encoding
+	encode := func(encodings ...string) []byte {
+		b := want
+		for _, enc := range encodings {
+			var buf bytes.Buffer
+			zw := writers[enc](&buf)
+			zw.Write(b)
+			if err := zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			b = buf.Bytes()
+		}
+		return b
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings := strings.Split(r.URL.Query().Get("enc"), ",")
+		w.Header().Set("Content-Encoding", strings.Join(encodings, ", "))
+		w.Write(encode(encodings...))
+	}))
+	defer srv.Close()
+
+	for _, enc := range []string{"zlib,gzip", "gzip,zlib,br"} {
+		res, err := New().Get(srv.URL).SetQuery("enc", enc).
+			SetHeader("Accept-Encoding", "gzip, zlib, br").Exec()
+		if err != nil {
+			t.Fatalf("%s: %v", enc, err)
+		}
+		got, err := res.Bytes()
+		res.Body.Close()
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("%s: decoded %d bytes (err %v), want %d matching bytes",
+				enc, len(got), err, len(want))
+		}
+	}
+
+	// Unknown token in the chain is named in the error
+	writers["x-custom"] = writers["gzip"]
+	_, err := New().Get(srv.URL).SetQuery("enc", "gzip,x-custom").
+		SetHeader("Accept-Encoding", "gzip, x-custom").Exec()
+	if err == nil || !strings.Contains(err.Error(), "x-custom") {
+		t.Fatalf("err = %v, want error naming x-custom", err)
+	}
+}
+
+func TestTreatContentTypeAsEncoding(t *testing.T) {
+	want := []byte("archived httpx payload")
+	compressed := gzipBytes(t, want)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Write(compressed)
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		name    string
+		mapping map[string]string
+		want    []byte
+	}{
+		{"mapped", map[string]string{"application/gzip": "gzip"}, want},
+		{"unmapped", nil, compressed},
+	} {
+		res, err := New().Get(srv.URL).TreatContentTypeAsEncoding(tt.mapping).Exec()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, err := res.Bytes()
+		res.Body.Close()
+		if err != nil || !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: body = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}